@@ -2,18 +2,60 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"slices"
+	"time"
+
 	"github.com/alknopfler/seactl/pkg/airgap"
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/filter"
+	"github.com/alknopfler/seactl/pkg/logger"
+	"github.com/alknopfler/seactl/pkg/progress"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/report"
+	"github.com/alknopfler/seactl/pkg/rke2"
+	"github.com/alknopfler/seactl/pkg/semver"
+	"github.com/alknopfler/seactl/pkg/transport"
 	"github.com/spf13/cobra"
 )
 
 var (
 	releaseVersion   string
 	releaseMode      string
+	releaseSources   []string
 	registryAuthFile string
 	registryURL      string
 	registryCACert   string
 	registryInsecure bool
+	registryCert     string
+	registryKey      string
 	outputDirTarball string
+	outputOCILayout  string
+	imagesArchive    string
+	archiveMaxImages int
+	rke2Upload       bool
+	rke2ImagesUpload bool
+	rke2CNIs         []string
+	rke2ReleaseURL   string
+	rke2InstallURL   string
+	kubernetes       string
+	components       []string
+	proxy            string
+	sourceCACert     string
+	sourceAuthFile   string
+	rewrites         []string
+	concurrency      int
+	configFile       string
+	includeImages    []string
+	excludeImages    []string
+	includeCharts    []string
+	excludeCharts    []string
+	chartImages      bool
+	additionsFile    string
+	reportFormat     string
+	reportStdout     bool
+	noProgress       bool
+	progressInterval time.Duration
 	dryRun           bool
 )
 
@@ -21,45 +63,230 @@ func NewAirGapCommand() *cobra.Command {
 	c := &cobra.Command{
 		Use:   "generate",
 		Short: "Command to generate the air-gap artifacts from the airgap manifest",
+		// The config file is applied before cobra checks the required flags
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return applyConfig(cmd.Flags(), configFile)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Check helm
-			if err := airgap.CheckHelmCommand(); err != nil {
+			selected, err := selectedComponents(cmd)
+			if err != nil {
 				return err
 			}
+			has := func(component string) bool { return slices.Contains(selected, component) }
+
+			// Check helm, used to mirror and to render the charts
+			if airgap.UsesHelm(selected, chartImages) {
+				if err := airgap.CheckHelmCommand(); err != nil {
+					return err
+				}
+			}
+
+			// Validate the custom release sources and the release mode
+			if err := config.SetReleaseSources(releaseSources); err != nil {
+				return fmt.Errorf("invalid value for --release-source: %v", err)
+			}
+			if err := config.ValidateReleaseMode(releaseMode); err != nil {
+				return fmt.Errorf("invalid value for --release-mode: %v", err)
+			}
+
+			// Validate the release version, X.Y.Z with an optional pre-release tag
+			if _, err := semver.ParseRelease(releaseVersion); err != nil {
+				return fmt.Errorf("invalid release version format: %v", err)
+			}
+
+			// Validate images archive format
+			if imagesArchive != "" && imagesArchive != "tar" && imagesArchive != "tar.zst" {
+				return fmt.Errorf("invalid value for --images-archive: %s, allowed: 'tar' or 'tar.zst'", imagesArchive)
+			}
+
+			// Validate the selected CNIs
+			if err := rke2.ValidateCNIs(rke2CNIs); err != nil {
+				return fmt.Errorf("invalid value for --rke2-cni: %v", err)
+			}
+
+			// Validate the RKE2 mirror URLs
+			if err := rke2.ValidateURLTemplate(rke2ReleaseURL); err != nil {
+				return fmt.Errorf("invalid value for --rke2-release-url: %v", err)
+			}
+			if err := rke2.ValidateURLTemplate(rke2InstallURL); err != nil {
+				return fmt.Errorf("invalid value for --rke2-install-url: %v", err)
+			}
+
+			// Validate the run report format
+			if err := report.ValidateFormat(reportFormat); err != nil {
+				return fmt.Errorf("invalid value for --report-format: %v", err)
+			}
+
+			// Mutual TLS needs both the client certificate and key
+			if (registryCert == "") != (registryKey == "") {
+				return fmt.Errorf("--registry-cert and --registry-key must be provided together")
+			}
+
+			// Pushing the RKE2 artifacts needs a registry
+			if rke2Upload && registryURL == "" {
+				return fmt.Errorf("--rke2-upload requires --registry-url")
+			}
+			if rke2ImagesUpload && registryURL == "" {
+				return fmt.Errorf("--rke2-images-upload requires --registry-url")
+			}
+
+			// Repository rewrites in the registry
+			var rules []registry.Rewrite
+			for _, rule := range rewrites {
+				rw, err := registry.ParseRewrite(rule)
+				if err != nil {
+					return fmt.Errorf("invalid value for --rewrite: %v", err)
+				}
+				rules = append(rules, rw)
+			}
+
+			// Images and charts selection
+			imageFilter, err := filter.New(includeImages, excludeImages)
+			if err != nil {
+				return fmt.Errorf("invalid value for --include-images/--exclude-images: %v", err)
+			}
+			chartFilter, err := filter.New(includeCharts, excludeCharts)
+			if err != nil {
+				return fmt.Errorf("invalid value for --include-charts/--exclude-charts: %v", err)
+			}
+
+			// Images and charts on top of the release manifest
+			var additions *config.Additions
+			if additionsFile != "" {
+				if additions, err = config.LoadAdditions(additionsFile); err != nil {
+					return err
+				}
+			}
+
+			if concurrency < 1 {
+				return fmt.Errorf("invalid value for --concurrency: %d, must be at least 1", concurrency)
+			}
+
+			// The output directory holds the RKE2/K3s files and the images archives
+			if outputDirTarball == "" {
+				if has(airgap.ComponentRKE2) || has(airgap.ComponentK3S) {
+					return fmt.Errorf("--output is required by the rke2 and k3s components")
+				}
+				if has(airgap.ComponentImages) && imagesArchive != "" {
+					return fmt.Errorf("--images-archive requires --output")
+				}
+			}
+
+			// At least one sink is needed for the images
+			if has(airgap.ComponentImages) && registryURL == "" && outputOCILayout == "" && imagesArchive == "" {
+				return fmt.Errorf("at least one of --registry-url, --oci-layout or --images-archive must be provided")
+			}
 
-			// Validate release mode
-			if releaseMode != "factory" && releaseMode != "production" {
-				return fmt.Errorf("invalid value for --release-mode: %s, allowed: 'factory' or 'production'", releaseMode)
+			// The charts are only pushed to a registry, they are skipped without one unless explicitly selected
+			if cmd.Flags().Changed("components") && has(airgap.ComponentHelm) && registryURL == "" {
+				return fmt.Errorf("the helm component requires --registry-url")
 			}
 
-			// Validate release version format X.Y.Z
-			if releaseVersion == "" || len(releaseVersion) < 5 || releaseVersion[1] != '.' || releaseVersion[3] != '.' {
-				return fmt.Errorf("invalid release version format: %s, expected format X.Y.Z", releaseVersion)
+			// Proxy, source CA bundle and source credentials for every outbound connection
+			if err := transport.Configure(transport.Settings{Proxy: proxy, SourceCACert: sourceCACert, SourceAuthFile: sourceAuthFile}); err != nil {
+				return err
+			}
+
+			// Live progress on a terminal, summary lines every --progress-interval otherwise
+			if !noProgress {
+				progress.SetDefault(progress.New(os.Stderr, logger.IsTerminal(os.Stderr), progressInterval))
 			}
 
 			// Call airgap generation
-			return airgap.GenerateAirGapEnvironment(
-				dryRun, releaseVersion, releaseMode,
-				registryURL, registryAuthFile, registryCACert,
-				outputDirTarball, registryInsecure,
-			)
+			return airgap.GenerateAirGapEnvironment(airgap.Options{
+				DryRun:           dryRun,
+				ReleaseVersion:   releaseVersion,
+				ReleaseMode:      releaseMode,
+				RegistryURL:      registryURL,
+				RegistryAuthFile: registryAuthFile,
+				RegistryCACert:   registryCACert,
+				RegistryInsecure: registryInsecure,
+				RegistryCert:     registryCert,
+				RegistryKey:      registryKey,
+				OutputDirTarball: outputDirTarball,
+				OutputOCILayout:  outputOCILayout,
+				ImagesArchive:    imagesArchive,
+				ArchiveMaxImages: archiveMaxImages,
+				RKE2Upload:       rke2Upload,
+				RKE2ImagesUpload: rke2ImagesUpload,
+				RKE2CNIs:         rke2CNIs,
+				RKE2ReleaseURL:   rke2ReleaseURL,
+				RKE2InstallURL:   rke2InstallURL,
+				Kubernetes:       kubernetes,
+				Components:       selected,
+				ReportFormat:     reportFormat,
+				ReportStdout:     reportStdout,
+				Concurrency:      concurrency,
+				Rewrites:         rules,
+				Filters:          airgap.Filters{Images: imageFilter, Charts: chartFilter, ChartImages: chartImages},
+				Additions:        additions,
+			})
 		},
 	}
 
+	addGenerateFlags(c)
+	return c
+}
+
+// addGenerateFlags adds the flags of a generate run to c, preflight checks the same run
+func addGenerateFlags(c *cobra.Command) {
 	flags := c.Flags()
-	flags.StringVarP(&releaseVersion, "release-version", "v", "", "SUSE Edge release version (X.Y.Z)")
-	flags.StringVarP(&releaseMode, "release-mode", "m", "factory", "Release mode: factory or production")
+	flags.StringVarP(&releaseVersion, "release-version", "v", "", "SUSE Edge release version (X.Y.Z, e.g. 3.1.0 or 3.2.0-rc1)")
+	flags.StringVarP(&releaseMode, "release-mode", "m", "factory", "Release mode: factory, production, a --release-source name or a release source spec")
+	flags.StringArrayVar(&releaseSources, "release-source", nil, "Custom release mode NAME=SPEC, SPEC being oci://IMAGE, dir://PATH or http(s)://URL, templated with {{.Version}} and {{.Stream}} (repeatable)")
 	flags.StringVarP(&registryURL, "registry-url", "r", "", "Registry URL")
 	flags.StringVarP(&registryCACert, "registry-cacert", "c", "", "Registry CA Certificate")
 	flags.StringVarP(&registryAuthFile, "registry-authfile", "a", "", "Registry Auth file")
 	flags.BoolVarP(&registryInsecure, "insecure", "k", false, "Skip TLS verification")
+	flags.StringVar(&registryCert, "registry-cert", "", "Client certificate for registries requiring mutual TLS")
+	flags.StringVar(&registryKey, "registry-key", "", "Client key for registries requiring mutual TLS")
 	flags.StringVarP(&outputDirTarball, "output", "o", "", "Output directory for tarball files")
+	flags.StringVar(&outputOCILayout, "oci-layout", "", "OCI image-layout directory where the images are also written")
+	flags.StringVar(&imagesArchive, "images-archive", "", "Also pack the images as docker-archive tarballs in the output directory: tar or tar.zst")
+	flags.IntVar(&archiveMaxImages, "images-archive-split", 0, "Max images per docker-archive tarball (0 means a single tarball)")
+	flags.BoolVar(&rke2Upload, "rke2-upload", false, "Also push the RKE2 artifacts to the registry as OCI artifacts")
+	flags.BoolVar(&rke2ImagesUpload, "rke2-images-upload", false, "Also push the images inside the rke2-images tarballs to the registry")
+	flags.StringSliceVar(&rke2CNIs, "rke2-cni", nil, "Only download the core RKE2 images plus these CNI bundles (calico, canal, cilium, flannel, multus), all of them when empty")
+	flags.StringVar(&rke2ReleaseURL, "rke2-release-url", rke2.RKE2ReleaseURL, "RKE2 release files URL: a base URL followed by the version, or a template with {{.Version}} and {{.RawVersion}}")
+	flags.StringVar(&rke2InstallURL, "rke2-install-url", rke2.RKE2URL, "RKE2 install.sh script URL, may be a template with {{.Version}} and {{.RawVersion}}")
+	flags.StringSliceVar(&components, "components", nil, "Components of the run: images, helm, rke2 and/or k3s (default images, helm and the --kubernetes distribution)")
+	flags.StringVar(&kubernetes, "kubernetes", airgap.KubernetesRKE2, "Kubernetes distribution artifacts to download: rke2, k3s or both")
+	flags.StringVar(&proxy, "proxy", "", "Proxy URL for all outbound traffic, overrides HTTPS_PROXY/HTTP_PROXY (NO_PROXY is honoured)")
+	flags.StringVar(&sourceCACert, "source-cacert", "", "CA bundle trusted to pull the release manifest, images, charts and RKE2/K3s artifacts")
+	flags.StringVar(&sourceAuthFile, "source-authfile", "", "docker/podman auth.json with the credentials of the source registries (release manifest, images and OCI charts)")
+	flags.StringArrayVar(&rewrites, "rewrite", nil, "Rewrite the repositories of the images and OCI charts in the registry: FROM=TO, e.g. registry.suse.com/edge=mirror/edge (repeatable, the first matching rule applies)")
+	flags.IntVar(&concurrency, "concurrency", 1, "Number of images mirrored in parallel")
+	flags.StringVar(&additionsFile, "additions", "", "File listing extra images and helm charts to mirror on top of the release manifest ones")
+	flags.StringArrayVar(&includeImages, "include-images", nil, "Only mirror the images matching one of these patterns: globs (* matching any characters) or regular expressions prefixed with re: (repeatable)")
+	flags.StringArrayVar(&excludeImages, "exclude-images", nil, "Do not mirror the images matching one of these patterns (repeatable)")
+	flags.StringArrayVar(&includeCharts, "include-charts", nil, "Only mirror the helm charts whose release name matches one of these patterns (repeatable)")
+	flags.StringArrayVar(&excludeCharts, "exclude-charts", nil, "Do not mirror the helm charts whose release name matches one of these patterns (repeatable)")
+	flags.BoolVar(&chartImages, "chart-images", false, "Only mirror the images referenced by the selected helm charts, rendered with their default values")
+	flags.StringVarP(&configFile, "config", "f", "", "SeactlConfig file, the flags and the SEACTL_* environment variables override it (default $"+ConfigEnv+")")
+	flags.StringVar(&reportFormat, "report-format", report.FormatJSON, "Format of the run report written to the output directory: json or yaml")
+	flags.BoolVar(&reportStdout, "report-stdout", false, "Also print the run report to stdout")
+	flags.BoolVar(&noProgress, "no-progress", false, "Do not show the progress of the run")
+	flags.DurationVar(&progressInterval, "progress-interval", progress.DefaultInterval, "Period of the progress summary lines when stderr is not a terminal")
 	flags.BoolVarP(&dryRun, "dry-run", "d", false, "Dry run mode")
 
-	// Required flags
+	// Required flags, --output and --registry-url depend on the components
 	c.MarkFlagRequired("release-version")
-	c.MarkFlagRequired("output")
-	c.MarkFlagRequired("registry-url")
+}
 
-	return c
+// selectedComponents returns the components of the run: --components, or the default ones with the
+// --kubernetes distribution
+func selectedComponents(cmd *cobra.Command) ([]string, error) {
+	if err := airgap.ValidateKubernetes(kubernetes); err != nil {
+		return nil, fmt.Errorf("invalid value for --kubernetes: %v", err)
+	}
+	if !cmd.Flags().Changed("components") {
+		return airgap.DefaultComponents(kubernetes), nil
+	}
+	if cmd.Flags().Changed("kubernetes") {
+		return nil, fmt.Errorf("--kubernetes cannot be combined with --components, select rke2 and/or k3s in --components")
+	}
+	if err := airgap.ValidateComponents(components); err != nil {
+		return nil, fmt.Errorf("invalid value for --components: %v", err)
+	}
+	return components, nil
 }
@@ -7,6 +7,10 @@ import (
 	"testing"
 
 	"github.com/alknopfler/seactl/pkg/airgap"
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/progress"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/transport"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,16 +21,7 @@ var (
 	helmCalled  bool
 	generateErr error
 
-	generateParams struct {
-		dryRun           bool
-		releaseVersion   string
-		releaseMode      string
-		registryURL      string
-		registryAuthFile string
-		registryCACert   string
-		outputDir        string
-		registryInsecure bool
-	}
+	generateParams airgap.Options
 )
 
 // Mock functions
@@ -35,19 +30,8 @@ func fakeCheckHelm() error {
 	return nil
 }
 
-func fakeGenerate(
-	dryRun bool, rv, rm, url, auth, cacert, out string, insecure bool,
-) error {
-	generateParams = struct {
-		dryRun           bool
-		releaseVersion   string
-		releaseMode      string
-		registryURL      string
-		registryAuthFile string
-		registryCACert   string
-		outputDir        string
-		registryInsecure bool
-	}{dryRun, rv, rm, url, auth, cacert, out, insecure}
+func fakeGenerate(opts airgap.Options) error {
+	generateParams = opts
 	return generateErr
 }
 
@@ -128,16 +112,7 @@ func TestInvalidVersionFormat_Error(t *testing.T) {
 
 func TestGenerate_Success(t *testing.T) {
 	helmCalled = false
-	generateParams = struct {
-		dryRun           bool
-		releaseVersion   string
-		releaseMode      string
-		registryURL      string
-		registryAuthFile string
-		registryCACert   string
-		outputDir        string
-		registryInsecure bool
-	}{}
+	generateParams = airgap.Options{}
 
 	stdout, stderr, err := runCommand([]string{
 		"--release-mode", "production",
@@ -155,12 +130,397 @@ func TestGenerate_Success(t *testing.T) {
 	assert.Equal(t, "", stderr)
 
 	assert.True(t, helmCalled)
-	assert.Equal(t, "production", generateParams.releaseMode)
-	assert.Equal(t, "1.2.3", generateParams.releaseVersion)
-	assert.Equal(t, "reg", generateParams.registryURL)
-	assert.Equal(t, "auth", generateParams.registryAuthFile)
-	assert.Equal(t, "cacert", generateParams.registryCACert)
-	assert.Equal(t, "out", generateParams.outputDir)
-	assert.True(t, generateParams.dryRun)
-	assert.True(t, generateParams.registryInsecure)
+	assert.Equal(t, "production", generateParams.ReleaseMode)
+	assert.Equal(t, "1.2.3", generateParams.ReleaseVersion)
+	assert.Equal(t, "reg", generateParams.RegistryURL)
+	assert.Equal(t, "auth", generateParams.RegistryAuthFile)
+	assert.Equal(t, "cacert", generateParams.RegistryCACert)
+	assert.Equal(t, "out", generateParams.OutputDirTarball)
+	assert.True(t, generateParams.DryRun)
+	assert.True(t, generateParams.RegistryInsecure)
+}
+
+func TestGenerate_OCILayoutWithoutRegistry(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--oci-layout", "layout",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "", generateParams.RegistryURL)
+	assert.Equal(t, "layout", generateParams.OutputOCILayout)
+}
+
+func TestGenerate_NoImageSink_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--registry-url, --oci-layout or --images-archive")
+}
+
+func TestGenerate_ImagesArchive(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--images-archive", "tar.zst",
+		"--images-archive-split", "50",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "tar.zst", generateParams.ImagesArchive)
+	assert.Equal(t, 50, generateParams.ArchiveMaxImages)
+}
+
+func TestGenerate_InvalidImagesArchive_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--images-archive", "zip",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid value for --images-archive")
+}
+
+func TestGenerate_RKE2CNI(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--rke2-cni", "cilium,multus",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cilium", "multus"}, generateParams.RKE2CNIs)
+}
+
+func TestGenerate_InvalidRKE2CNI_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--rke2-cni", "weave",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid value for --rke2-cni")
+}
+
+func TestGenerate_Kubernetes(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--kubernetes", "both",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, airgap.KubernetesBoth, generateParams.Kubernetes)
+}
+
+func TestGenerate_InvalidKubernetes_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--kubernetes", "k8s",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid value for --kubernetes")
+}
+
+func TestGenerate_RKE2Mirror(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--rke2-release-url", "https://mirror.local/rke2/{{.Version}}/",
+		"--rke2-install-url", "https://mirror.local/rke2/install.sh",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://mirror.local/rke2/{{.Version}}/", generateParams.RKE2ReleaseURL)
+	assert.Equal(t, "https://mirror.local/rke2/install.sh", generateParams.RKE2InstallURL)
+}
+
+func TestGenerate_InvalidRKE2ReleaseURL_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--rke2-release-url", "https://mirror.local/{{.Os}}/",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid value for --rke2-release-url")
+}
+
+func TestGenerate_Proxy(t *testing.T) {
+	defer transport.Configure(transport.Settings{})
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--proxy", "http://proxy.local:3128",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy.local:3128", transport.Current().Proxy)
+}
+
+func TestGenerate_InvalidProxy_Error(t *testing.T) {
+	defer transport.Configure(transport.Settings{})
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--proxy", "proxy.local",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid proxy URL")
+}
+
+func TestGenerate_SourceAuthFile(t *testing.T) {
+	defer transport.Configure(transport.Settings{})
+	authFile := t.TempDir() + "/auth.json"
+	assert.NoError(t, os.WriteFile(authFile, []byte(`{"auths":{"mirror.local":{"auth":"dXNlcjpwYXNz"}}}`), 0600))
+
+	_, _, err := runCommand([]string{"--release-version", "1.2.3", "--output", "out", "--registry-url", "reg", "--source-authfile", authFile})
+	assert.NoError(t, err)
+	assert.Equal(t, authFile, transport.Current().SourceAuthFile)
+
+	_, _, err = runCommand([]string{"--release-version", "1.2.3", "--output", "out", "--registry-url", "reg", "--source-authfile", "/does/not/exist.json"})
+	assert.Error(t, err)
+}
+
+func TestGenerate_Rewrite(t *testing.T) {
+	generateParams = airgap.Options{}
+	_, _, err := runCommand([]string{"--release-version", "1.2.3", "--output", "out", "--registry-url", "reg",
+		"--rewrite", "registry.suse.com/edge=mirror/edge", "--rewrite", "docker.io=hub"})
+	assert.NoError(t, err)
+	assert.Equal(t, []registry.Rewrite{{From: "registry.suse.com/edge", To: "mirror/edge"}, {From: "docker.io", To: "hub"}}, generateParams.Rewrites)
+
+	_, _, err = runCommand([]string{"--release-version", "1.2.3", "--output", "out", "--registry-url", "reg", "--rewrite", "registry.suse.com"})
+	assert.ErrorContains(t, err, "--rewrite")
+}
+
+func TestGenerate_Concurrency(t *testing.T) {
+	generateParams = airgap.Options{}
+	_, _, err := runCommand([]string{"--release-version", "1.2.3", "--output", "out", "--registry-url", "reg", "--concurrency", "4"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, generateParams.Concurrency)
+
+	_, _, err = runCommand([]string{"--release-version", "1.2.3", "--output", "out", "--registry-url", "reg", "--concurrency", "0"})
+	assert.ErrorContains(t, err, "--concurrency")
+}
+
+func TestGenerate_RegistryClientCert(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--registry-cert", "client.crt",
+		"--registry-key", "client.key",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "client.crt", generateParams.RegistryCert)
+	assert.Equal(t, "client.key", generateParams.RegistryKey)
+}
+
+func TestGenerate_RegistryCertWithoutKey_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--registry-cert", "client.crt",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--registry-cert and --registry-key must be provided together")
+}
+
+func TestGenerate_Report(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--report-format", "yaml",
+		"--report-stdout",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml", generateParams.ReportFormat)
+	assert.True(t, generateParams.ReportStdout)
+}
+
+func TestGenerate_InvalidReportFormat_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--report-format", "xml",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid value for --report-format")
+}
+
+func TestGenerate_Progress(t *testing.T) {
+	orig := progress.Default()
+	defer progress.SetDefault(orig)
+
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--progress-interval", "1m",
+	})
+	assert.NoError(t, err)
+	assert.True(t, progress.Default().Enabled())
+
+	progress.SetDefault(&progress.Tracker{})
+	_, _, err = runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--registry-url", "reg",
+		"--no-progress",
+	})
+	assert.NoError(t, err)
+	assert.False(t, progress.Default().Enabled())
+}
+
+func TestGenerate_Filters(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{
+		"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg",
+		"--exclude-images", "*neuvector*", "--exclude-images", "re:^docker\\.io/(nginx|busybox)",
+		"--include-charts", "rancher", "--chart-images",
+	})
+	assert.NoError(t, err)
+
+	f := generateParams.Filters
+	assert.True(t, f.ChartImages)
+	ok, _ := f.Images.Match("registry.suse.com/rancher/neuvector-controller:5.4.0")
+	assert.False(t, ok)
+	ok, _ = f.Images.Match("registry.suse.com/rancher/rancher:v2.9.1")
+	assert.True(t, ok)
+	ok, _ = f.Charts.Match("metal3")
+	assert.False(t, ok)
+}
+
+func TestGenerate_InvalidFilter_Error(t *testing.T) {
+	_, _, err := runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg", "--exclude-charts", "re:("})
+	assert.ErrorContains(t, err, "--exclude-charts")
+}
+
+func TestGenerate_Components(t *testing.T) {
+	generateParams = airgap.Options{}
+	helmCalled = false
+
+	// only the images to an OCI layout: neither --output nor --registry-url nor helm needed
+	_, _, err := runCommand([]string{"--release-version", "3.1.0", "--components", "images", "--oci-layout", "/tmp/oci"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"images"}, generateParams.Components)
+	assert.False(t, helmCalled)
+
+	_, _, err = runCommand([]string{"--release-version", "3.1.0", "--components", "helm", "--registry-url", "reg"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"helm"}, generateParams.Components)
+	assert.True(t, helmCalled)
+
+	// default: images, helm and the --kubernetes distribution
+	_, _, err = runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg", "--kubernetes", "k3s"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"images", "helm", "k3s"}, generateParams.Components)
+}
+
+func TestGenerate_Components_Error(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--components", "images,charts", "--registry-url", "reg"}, "charts"},
+		{[]string{"--components", "rke2", "--registry-url", "reg"}, "--output is required"},
+		{[]string{"--components", "helm"}, "requires --registry-url"},
+		{[]string{"--components", "images", "--output", "out"}, "at least one of"},
+		{[]string{"--components", "images", "--images-archive", "tar"}, "--images-archive requires --output"},
+		{[]string{"--components", "rke2", "--kubernetes", "k3s", "--output", "out"}, "--kubernetes cannot be combined"},
+		{[]string{"--registry-url", "reg"}, "--output is required"},
+	}
+	for _, tt := range tests {
+		_, _, err := runCommand(append([]string{"--release-version", "3.1.0"}, tt.args...))
+		assert.ErrorContains(t, err, tt.want, tt.args)
+	}
+}
+
+func TestGenerate_Additions(t *testing.T) {
+	generateParams = airgap.Options{}
+	path := writeTestConfig(t, "images:\n  - name: registry.example.com/operators/my-operator:1.2.0\n")
+
+	_, _, err := runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg", "--additions", path})
+	assert.NoError(t, err)
+	if assert.NotNil(t, generateParams.Additions) {
+		assert.Equal(t, "registry.example.com/operators/my-operator:1.2.0", generateParams.Additions.Images[0].Name)
+	}
+
+	_, _, err = runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg", "--additions", writeTestConfig(t, "helm:\n  - chart: foo\n")})
+	assert.ErrorContains(t, err, "helm[0]")
+}
+
+func TestGenerate_ReleaseVersion(t *testing.T) {
+	for _, version := range []string{"3.10.0", "10.1.0", "3.2.0-rc1"} {
+		generateParams = airgap.Options{}
+		_, _, err := runCommand([]string{"--release-version", version, "--output", "out", "--registry-url", "reg"})
+		assert.NoError(t, err, version)
+		assert.Equal(t, version, generateParams.ReleaseVersion)
+	}
+	for _, version := range []string{"3.1.x", "3.1", "v3.1.0", "3.1.0+build1"} {
+		_, _, err := runCommand([]string{"--release-version", version, "--output", "out", "--registry-url", "reg"})
+		assert.ErrorContains(t, err, "invalid release version format", version)
+	}
+}
+
+func TestGenerate_ReleaseSource(t *testing.T) {
+	defer config.SetReleaseSources(nil)
+	generateParams = airgap.Options{}
+	_, _, err := runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg",
+		"--release-source", "local=dir:///srv/edge-manifests", "--release-mode", "local"})
+	assert.NoError(t, err)
+	assert.Equal(t, "local", generateParams.ReleaseMode)
+
+	// a spec is a release mode of its own
+	_, _, err = runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg",
+		"--release-mode", "https://manifests.local/edge"})
+	assert.NoError(t, err)
+
+	_, _, err = runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg",
+		"--release-source", "local=ftp://manifests.local"})
+	assert.ErrorContains(t, err, "invalid value for --release-source")
+	_, _, err = runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg",
+		"--release-mode", "local"})
+	assert.ErrorContains(t, err, "invalid value for --release-mode")
 }
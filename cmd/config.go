@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alknopfler/seactl/pkg/airgap"
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// ConfigEnv holds the config file used when --config is not set
+	ConfigEnv = "SEACTL_CONFIG"
+	// envPrefix prefixes the environment variables overriding the config file, e.g. SEACTL_REGISTRY_URL
+	envPrefix = "SEACTL_"
+	// defaultConfigFile is the file written by config init
+	defaultConfigFile = "seactl.yaml"
+)
+
+var (
+	configInitOutput string
+	configInitForce  bool
+	configValidate   string
+
+	// lookupEnv is assignable for testing
+	lookupEnv = os.LookupEnv
+)
+
+func NewConfigCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the SeactlConfig file of the generate runs",
+	}
+	c.AddCommand(newConfigInitCommand())
+	c.AddCommand(newConfigValidateCommand())
+	return c
+}
+
+func newConfigInitCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "init",
+		Short: "Write a commented SeactlConfig file with the default settings",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := os.Stat(configInitOutput); err == nil && !configInitForce {
+				return fmt.Errorf("%s already exists, use --force to overwrite it", configInitOutput)
+			}
+			if err := os.WriteFile(configInitOutput, []byte(config.SeactlConfigTemplate), 0644); err != nil {
+				return fmt.Errorf("writing config file: %v", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "config file written to %s\n", configInitOutput)
+			return nil
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVarP(&configInitOutput, "output", "o", defaultConfigFile, "Path of the config file")
+	flags.BoolVar(&configInitForce, "force", false, "Overwrite an existing config file")
+	return c
+}
+
+func newConfigValidateCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate a SeactlConfig file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := configValidate
+			if path == "" {
+				path, _ = lookupEnv(ConfigEnv)
+			}
+			if path == "" {
+				return fmt.Errorf("--config must be provided")
+			}
+			if _, err := loadConfig(path); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", path)
+			return nil
+		},
+	}
+
+	c.Flags().StringVarP(&configValidate, "config", "f", "", "SeactlConfig file to validate (default $"+ConfigEnv+")")
+	return c
+}
+
+// loadConfig reads the config file at path and validates it, including the fields owned by the airgap package
+func loadConfig(path string) (*config.SeactlConfig, error) {
+	cfg, err := config.LoadSeactlConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := airgap.ValidateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// EnvName returns the environment variable overriding flag, e.g. SEACTL_REGISTRY_URL for --registry-url
+func EnvName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyConfig sets the flags not given on the command line from their SEACTL_* environment variable, or
+// else from the config file at path ($SEACTL_CONFIG when empty, none when both are empty)
+func applyConfig(flags *pflag.FlagSet, path string) error {
+	if path == "" {
+		path, _ = lookupEnv(ConfigEnv)
+	}
+	values := map[string][]string{}
+	if path != "" {
+		cfg, err := loadConfig(path)
+		if err != nil {
+			return err
+		}
+		values = cfg.Flags()
+	}
+
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "config" {
+			return
+		}
+		source := "config file " + path
+		vals, ok := values[f.Name]
+		if env, set := lookupEnv(EnvName(f.Name)); set {
+			source, vals, ok = EnvName(f.Name), []string{env}, true
+			// the repeatable flags take one value per line, commas being valid in the values (re:a{1,3})
+			if f.Value.Type() == "stringArray" {
+				vals = strings.FieldsFunc(env, func(r rune) bool { return r == '\n' })
+			}
+		}
+		if !ok {
+			return
+		}
+		for _, v := range vals {
+			if setErr := flags.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("invalid value %q for --%s from %s: %v", v, f.Name, source, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/airgap"
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `apiVersion: seactl.suse.com/v1alpha1
+kind: SeactlConfig
+release:
+  version: 3.1.0
+  mode: production
+target:
+  registry:
+    url: registry.local:5000
+  rewrites:
+    - from: registry.suse.com/edge
+      to: mirror/edge
+output:
+  dir: /data/airgap
+kubernetes:
+  rke2:
+    cnis: [canal]
+concurrency: 4
+`
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "seactl.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func runConfigCommand(args ...string) (string, error) {
+	c := NewConfigCommand()
+	var out bytes.Buffer
+	c.SetOut(&out)
+	c.SetErr(&out)
+	c.SetArgs(args)
+	err := c.Execute()
+	return out.String(), err
+}
+
+func TestGenerate_ConfigFile(t *testing.T) {
+	generateParams = airgap.Options{}
+
+	_, _, err := runCommand([]string{"--config", writeTestConfig(t, testConfig), "--dry-run"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "3.1.0", generateParams.ReleaseVersion)
+	assert.Equal(t, "production", generateParams.ReleaseMode)
+	assert.Equal(t, "registry.local:5000", generateParams.RegistryURL)
+	assert.Equal(t, "/data/airgap", generateParams.OutputDirTarball)
+	assert.Equal(t, []string{"canal"}, generateParams.RKE2CNIs)
+	assert.Equal(t, 4, generateParams.Concurrency)
+	assert.Equal(t, []registry.Rewrite{{From: "registry.suse.com/edge", To: "mirror/edge"}}, generateParams.Rewrites)
+	// not in the file, the flag default
+	assert.Equal(t, airgap.KubernetesRKE2, generateParams.Kubernetes)
+}
+
+func TestGenerate_ConfigFileOverrides(t *testing.T) {
+	generateParams = airgap.Options{}
+	t.Setenv(ConfigEnv, writeTestConfig(t, testConfig))
+	t.Setenv("SEACTL_REGISTRY_URL", "env.local:5000")
+	t.Setenv("SEACTL_CONCURRENCY", "8")
+	t.Setenv("SEACTL_REWRITE", "docker.io=hub\nquay.io=quay")
+
+	_, _, err := runCommand([]string{"--concurrency", "2", "--dry-run"})
+	require.NoError(t, err)
+
+	// flag over environment over file
+	assert.Equal(t, 2, generateParams.Concurrency)
+	assert.Equal(t, "env.local:5000", generateParams.RegistryURL)
+	assert.Equal(t, []registry.Rewrite{{From: "docker.io", To: "hub"}, {From: "quay.io", To: "quay"}}, generateParams.Rewrites)
+	assert.Equal(t, "3.1.0", generateParams.ReleaseVersion)
+}
+
+func TestGenerate_EnvRepeatableFlagKeepsCommas(t *testing.T) {
+	generateParams = airgap.Options{}
+	t.Setenv("SEACTL_INCLUDE_IMAGES", "re:^rancher/[a-z]{1,3}$\n*/longhorn*\n")
+
+	_, _, err := runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg", "--dry-run"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"re:^rancher/[a-z]{1,3}$", "*/longhorn*"}, includeImages)
+}
+
+func TestGenerate_InvalidConfigFile_Error(t *testing.T) {
+	_, _, err := runCommand([]string{"--config", writeTestConfig(t, "kind: SeactlConfig\n"), "--dry-run"})
+	assert.ErrorContains(t, err, "apiVersion")
+}
+
+func TestGenerate_InvalidConfigComponents_Error(t *testing.T) {
+	path := writeTestConfig(t, "apiVersion: seactl.suse.com/v1alpha1\nkind: SeactlConfig\ncomponents: [images, charts]\n")
+	_, _, err := runCommand([]string{"--config", path, "--dry-run"})
+	assert.ErrorContains(t, err, "invalid config file")
+	assert.ErrorContains(t, err, `components: unknown component "charts"`)
+}
+
+func TestGenerate_InvalidEnvOverride_Error(t *testing.T) {
+	t.Setenv("SEACTL_CONCURRENCY", "many")
+	_, _, err := runCommand([]string{"--release-version", "3.1.0", "--output", "out", "--registry-url", "reg"})
+	assert.ErrorContains(t, err, "SEACTL_CONCURRENCY")
+}
+
+func TestConfigInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seactl.yaml")
+
+	out, err := runConfigCommand("init", "-o", path)
+	require.NoError(t, err)
+	assert.Contains(t, out, path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, config.SeactlConfigTemplate, string(data))
+
+	_, err = runConfigCommand("init", "-o", path)
+	assert.ErrorContains(t, err, "--force")
+	_, err = runConfigCommand("init", "-o", path, "--force")
+	assert.NoError(t, err)
+
+	out, err = runConfigCommand("validate", "-f", path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "is valid")
+}
+
+func TestConfigValidate_Error(t *testing.T) {
+	_, err := runConfigCommand("validate", "-f", writeTestConfig(t, "apiVersion: v1\nkind: SeactlConfig\n"))
+	assert.ErrorContains(t, err, "apiVersion")
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "SEACTL_REGISTRY_URL", EnvName("registry-url"))
+	assert.Equal(t, "SEACTL_RKE2_CNI", EnvName("rke2-cni"))
+}
+
+func TestGenerate_ConfigFileReleaseSources(t *testing.T) {
+	generateParams = airgap.Options{}
+	defer config.SetReleaseSources(nil)
+
+	path := writeTestConfig(t, `apiVersion: seactl.suse.com/v1alpha1
+kind: SeactlConfig
+release:
+  version: 3.1.0
+  mode: staging
+  sources:
+    staging: oci://registry.local/edge/{{.Stream}}/release-manifest:{{.Version}}
+target:
+  registry:
+    url: registry.local:5000
+output:
+  dir: /data/airgap
+`)
+	_, _, err := runCommand([]string{"--config", path, "--dry-run"})
+	require.NoError(t, err)
+	assert.Equal(t, "staging", generateParams.ReleaseMode)
+	location, err := config.ReleaseManifestLocation("3.1.0", "staging")
+	require.NoError(t, err)
+	assert.Equal(t, "registry.local/edge/3.1/release-manifest:3.1.0", location)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/preflight"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/rke2"
+	"github.com/alknopfler/seactl/pkg/transport"
+	"github.com/spf13/cobra"
+)
+
+// PreflightRunFunc is assignable for testing
+var PreflightRunFunc = preflight.Run
+
+func NewPreflightCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "preflight",
+		Short: "Check the tools, network access, registry permissions and disk space a generate run depends on",
+		// The same flags, config file and SEACTL_* variables as generate, so the checked run is the one to start
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return applyConfig(cmd.Flags(), configFile)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selected, err := selectedComponents(cmd)
+			if err != nil {
+				return err
+			}
+			if err := config.SetReleaseSources(releaseSources); err != nil {
+				return fmt.Errorf("invalid value for --release-source: %v", err)
+			}
+			if (registryCert == "") != (registryKey == "") {
+				return fmt.Errorf("--registry-cert and --registry-key must be provided together")
+			}
+			if err := rke2.ValidateCNIs(rke2CNIs); err != nil {
+				return fmt.Errorf("invalid value for --rke2-cni: %v", err)
+			}
+			if err := transport.Configure(transport.Settings{Proxy: proxy, SourceCACert: sourceCACert, SourceAuthFile: sourceAuthFile}); err != nil {
+				return err
+			}
+
+			reg := registry.New(registryAuthFile, registryURL, registryCACert, registryInsecure)
+			reg.RegistryClientCert = registryCert
+			reg.RegistryClientKey = registryKey
+
+			results := PreflightRunFunc(preflight.Options{
+				ReleaseVersion: releaseVersion,
+				ReleaseMode:    releaseMode,
+				Registry:       reg,
+				OutputDir:      outputDirTarball,
+				Components:     selected,
+				ChartImages:    chartImages,
+				RKE2ReleaseURL: rke2ReleaseURL,
+				RKE2InstallURL: rke2InstallURL,
+				RKE2CNIs:       rke2CNIs,
+			})
+			preflight.Print(cmd.OutOrStdout(), results)
+
+			if failed := preflight.Failed(results); failed > 0 {
+				return fmt.Errorf("preflight failed: %d of %d checks failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+
+	addGenerateFlags(c)
+	return c
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/airgap"
+	"github.com/alknopfler/seactl/pkg/preflight"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreflight_FailedChecks_Error(t *testing.T) {
+	orig := PreflightRunFunc
+	defer func() { PreflightRunFunc = orig }()
+
+	var got preflight.Options
+	PreflightRunFunc = func(opts preflight.Options) []preflight.Result {
+		got = opts
+		return []preflight.Result{
+			{Name: "podman available", Status: preflight.StatusOK},
+			{Name: "target registry", Status: preflight.StatusFail, Hint: "check the credentials"},
+		}
+	}
+
+	var out bytes.Buffer
+	cmd := NewPreflightCommand()
+	cmd.SetArgs([]string{"-v", "3.1.0", "-m", "production", "-r", "registry.local:5000", "--rke2-cni", "cilium"})
+	cmd.SetOut(&out)
+	cmd.SilenceUsage = true
+
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 checks failed")
+	assert.Contains(t, out.String(), "hint: check the credentials")
+	assert.Equal(t, "3.1.0", got.ReleaseVersion)
+	assert.Equal(t, "production", got.ReleaseMode)
+	assert.Equal(t, "registry.local:5000", got.Registry.RegistryURL)
+	assert.Equal(t, []string{"cilium"}, got.RKE2CNIs)
+}
+
+// runPreflight runs the preflight command with args and returns the options of the checked run
+func runPreflight(t *testing.T, args ...string) (preflight.Options, error) {
+	t.Helper()
+	orig := PreflightRunFunc
+	t.Cleanup(func() { PreflightRunFunc = orig })
+
+	var got preflight.Options
+	PreflightRunFunc = func(opts preflight.Options) []preflight.Result {
+		got = opts
+		return nil
+	}
+	cmd := NewPreflightCommand()
+	cmd.SetArgs(args)
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SilenceUsage = true
+	return got, cmd.Execute()
+}
+
+func TestPreflight_ConfigFile(t *testing.T) {
+	t.Setenv("SEACTL_REGISTRY_URL", "env.local:5000")
+
+	// the same file and environment variables as generate
+	got, err := runPreflight(t, "--config", writeTestConfig(t, testConfig))
+	require.NoError(t, err)
+	assert.Equal(t, "3.1.0", got.ReleaseVersion)
+	assert.Equal(t, "production", got.ReleaseMode)
+	assert.Equal(t, "env.local:5000", got.Registry.RegistryURL)
+	assert.Equal(t, "/data/airgap", got.OutputDir)
+	assert.Equal(t, []string{"canal"}, got.RKE2CNIs)
+	assert.Equal(t, []string{airgap.ComponentImages, airgap.ComponentHelm, airgap.ComponentRKE2}, got.Components)
+}
+
+func TestPreflight_Kubernetes(t *testing.T) {
+	got, err := runPreflight(t, "-v", "3.1.0", "--kubernetes", "both")
+	require.NoError(t, err)
+	assert.Equal(t, []string{airgap.ComponentImages, airgap.ComponentHelm, airgap.ComponentRKE2, airgap.ComponentK3S}, got.Components)
+
+	got, err = runPreflight(t, "-v", "3.1.0", "--kubernetes", "k3s")
+	require.NoError(t, err)
+	assert.Equal(t, []string{airgap.ComponentImages, airgap.ComponentHelm, airgap.ComponentK3S}, got.Components)
+
+	got, err = runPreflight(t, "-v", "3.1.0", "--components", "images", "--chart-images")
+	require.NoError(t, err)
+	assert.Equal(t, []string{airgap.ComponentImages}, got.Components)
+	assert.True(t, got.ChartImages)
+
+	_, err = runPreflight(t, "-v", "3.1.0", "--kubernetes", "k8s")
+	assert.ErrorContains(t, err, "invalid value for --kubernetes")
+}
+
+func TestPreflight_ClientCertWithoutKey_Error(t *testing.T) {
+	cmd := NewPreflightCommand()
+	cmd.SetArgs([]string{"-v", "3.1.0", "--registry-cert", "client.crt"})
+	cmd.SilenceUsage = true
+
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--registry-cert and --registry-key")
+}
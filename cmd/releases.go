@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/releases"
+	"github.com/alknopfler/seactl/pkg/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	releasesMode           string
+	releasesSources        []string
+	releasesStreams        []string
+	releasesDetails        bool
+	releasesProxy          string
+	releasesSourceCACert   string
+	releasesSourceAuthFile string
+)
+
+// ReleasesListFunc is assignable for testing
+var ReleasesListFunc = releases.List
+
+func NewReleasesCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "releases",
+		Short: "Discover the SUSE Edge releases available in the release-manifest repositories",
+	}
+	c.AddCommand(newReleasesListCommand())
+	return c
+}
+
+func newReleasesListCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "list",
+		Short: "List the release versions of a mode, the highest first and the latest release marked",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.SetReleaseSources(releasesSources); err != nil {
+				return fmt.Errorf("invalid value for --release-source: %v", err)
+			}
+			if err := config.ValidateReleaseMode(releasesMode); err != nil {
+				return fmt.Errorf("invalid value for --mode: %v", err)
+			}
+			if err := transport.Configure(transport.Settings{Proxy: releasesProxy, SourceCACert: releasesSourceCACert, SourceAuthFile: releasesSourceAuthFile}); err != nil {
+				return err
+			}
+
+			list, err := ReleasesListFunc(releases.Options{Mode: releasesMode, Streams: releasesStreams, Details: releasesDetails})
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				return fmt.Errorf("no %s release found", releasesMode)
+			}
+			return releases.Print(cmd.OutOrStdout(), list, releasesDetails)
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVarP(&releasesMode, "mode", "m", "factory", "Release mode: factory, production, a --release-source name or an oci:// release source spec")
+	flags.StringArrayVar(&releasesSources, "release-source", nil, "Custom release mode NAME=SPEC, see generate --release-source (repeatable)")
+	flags.StringSliceVar(&releasesStreams, "stream", nil, "MAJOR.MINOR streams to list for a streamed mode like production, e.g. 3.1 (discovered from "+releases.FirstStream+" on when empty)")
+	flags.BoolVar(&releasesDetails, "details", false, "Also show the RKE2/K3s versions and the image and chart counts of every release (pulls every release manifest)")
+	flags.StringVar(&releasesProxy, "proxy", "", "Proxy URL for all outbound traffic, overrides HTTPS_PROXY/HTTP_PROXY (NO_PROXY is honoured)")
+	flags.StringVar(&releasesSourceCACert, "source-cacert", "", "CA bundle trusted to reach the release-manifest repositories")
+	flags.StringVar(&releasesSourceAuthFile, "source-authfile", "", "docker/podman auth.json with the credentials of the release-manifest repositories")
+	return c
+}
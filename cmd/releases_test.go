@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/releases"
+	"github.com/alknopfler/seactl/pkg/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runReleasesCommand(args ...string) (string, error) {
+	c := NewReleasesCommand()
+	var out bytes.Buffer
+	c.SetOut(&out)
+	c.SetErr(&out)
+	c.SetArgs(args)
+	err := c.Execute()
+	return out.String(), err
+}
+
+func TestReleasesList(t *testing.T) {
+	orig := ReleasesListFunc
+	defer func() { ReleasesListFunc = orig }()
+
+	var got releases.Options
+	ReleasesListFunc = func(opts releases.Options) ([]releases.Release, error) {
+		got = opts
+		v, err := semver.Parse("3.1.1")
+		require.NoError(t, err)
+		return []releases.Release{{Version: v, Latest: true}}, nil
+	}
+
+	out, err := runReleasesCommand("list", "--mode", "production", "--stream", "3.1")
+	require.NoError(t, err)
+	assert.Equal(t, releases.Options{Mode: "production", Streams: []string{"3.1"}}, got)
+	assert.Equal(t, "VERSION  LATEST\n3.1.1    *\n", out)
+}
+
+func TestReleasesList_Error(t *testing.T) {
+	orig := ReleasesListFunc
+	defer func() { ReleasesListFunc = orig }()
+	ReleasesListFunc = func(opts releases.Options) ([]releases.Release, error) { return nil, nil }
+
+	_, err := runReleasesCommand("list", "--mode", "staging")
+	assert.ErrorContains(t, err, "--mode")
+	_, err = runReleasesCommand("list", "--mode", "factory")
+	assert.ErrorContains(t, err, "no factory release found")
+}
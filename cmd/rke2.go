@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/rke2"
+	"github.com/alknopfler/seactl/pkg/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rke2Version          string
+	rke2RegistryURL      string
+	rke2RegistryAuthFile string
+	rke2RegistryCACert   string
+	rke2RegistryInsecure bool
+	rke2RegistryCert     string
+	rke2RegistryKey      string
+	rke2OutputDir        string
+	rke2Proxy            string
+)
+
+// RKE2PullFunc is assignable for testing
+var RKE2PullFunc = func(r *rke2.RKE2) error {
+	return r.Pull()
+}
+
+func NewRKE2Command() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "rke2",
+		Short: "Commands to manage the RKE2 artifacts stored in the registry",
+	}
+	c.AddCommand(newRKE2PullCommand())
+	return c
+}
+
+func newRKE2PullCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "pull",
+		Short: "Pull the RKE2 artifacts pushed with generate --rke2-upload from the registry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := transport.Configure(transport.Settings{Proxy: rke2Proxy}); err != nil {
+				return err
+			}
+			if (rke2RegistryCert == "") != (rke2RegistryKey == "") {
+				return fmt.Errorf("--registry-cert and --registry-key must be provided together")
+			}
+			reg := registry.New(rke2RegistryAuthFile, rke2RegistryURL, rke2RegistryCACert, rke2RegistryInsecure)
+			reg.RegistryClientCert = rke2RegistryCert
+			reg.RegistryClientKey = rke2RegistryKey
+			return RKE2PullFunc(rke2.New(rke2Version, rke2OutputDir, reg))
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVar(&rke2Version, "rke2-version", "", "RKE2 version to pull, e.g. v1.30.3+rke2r1")
+	flags.StringVarP(&rke2RegistryURL, "registry-url", "r", "", "Registry URL")
+	flags.StringVarP(&rke2RegistryCACert, "registry-cacert", "c", "", "Registry CA Certificate")
+	flags.StringVarP(&rke2RegistryAuthFile, "registry-authfile", "a", "", "Registry Auth file")
+	flags.BoolVarP(&rke2RegistryInsecure, "insecure", "k", false, "Skip TLS verification")
+	flags.StringVar(&rke2RegistryCert, "registry-cert", "", "Client certificate for registries requiring mutual TLS")
+	flags.StringVar(&rke2RegistryKey, "registry-key", "", "Client key for registries requiring mutual TLS")
+	flags.StringVarP(&rke2OutputDir, "output", "o", "", "Output directory for the RKE2 artifacts")
+	flags.StringVar(&rke2Proxy, "proxy", "", "Proxy URL, overrides HTTPS_PROXY/HTTP_PROXY (NO_PROXY is honoured)")
+
+	// Required flags
+	c.MarkFlagRequired("rke2-version")
+	c.MarkFlagRequired("registry-url")
+	c.MarkFlagRequired("output")
+
+	return c
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/rke2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRKE2Pull_Success(t *testing.T) {
+	origPull := RKE2PullFunc
+	defer func() { RKE2PullFunc = origPull }()
+
+	var pulled *rke2.RKE2
+	RKE2PullFunc = func(r *rke2.RKE2) error {
+		pulled = r
+		return nil
+	}
+
+	cmd := NewRKE2Command()
+	cmd.SetArgs([]string{"pull", "--rke2-version", "v1.30.3+rke2r1", "-r", "reg:5000", "-o", "out"})
+	assert.NoError(t, cmd.Execute())
+
+	assert.Equal(t, "v1.30.3+rke2r1", pulled.Version)
+	assert.Equal(t, "out", pulled.OutputDirTarball)
+}
+
+func TestGenerate_RKE2UploadWithoutRegistry_Error(t *testing.T) {
+	_, _, err := runCommand([]string{
+		"--release-version", "1.2.3",
+		"--output", "out",
+		"--oci-layout", "layout",
+		"--rke2-upload",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--rke2-upload requires --registry-url")
+}
+
+func TestRKE2Pull_ClientCert(t *testing.T) {
+	origPull := RKE2PullFunc
+	defer func() { RKE2PullFunc = origPull }()
+
+	var pulled *rke2.RKE2
+	RKE2PullFunc = func(r *rke2.RKE2) error {
+		pulled = r
+		return nil
+	}
+
+	cmd := NewRKE2Command()
+	cmd.SetArgs([]string{"pull", "--rke2-version", "v1.30.3+rke2r1", "-r", "reg:5000", "-o", "out", "--registry-cert", "client.crt", "--registry-key", "client.key"})
+	assert.NoError(t, cmd.Execute())
+	assert.NotNil(t, pulled)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alknopfler/seactl/pkg/serve"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveDir     string
+	serveListen  string
+	serveTLSCert string
+	serveTLSKey  string
+
+	artifactsDir          string
+	artifactsListen       string
+	artifactsTLSCert      string
+	artifactsTLSKey       string
+	artifactsAdvertiseURL string
+)
+
+func NewServeCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "serve",
+		Short: "Command to serve a bundle directory or OCI layout as a local read-only OCI registry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Validate TLS flags
+			if (serveTLSCert == "") != (serveTLSKey == "") {
+				return fmt.Errorf("--tls-cert and --tls-key must be provided together")
+			}
+
+			// Stop on SIGINT/SIGTERM, so the decompressed archives are removed
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			reg, err := serve.NewRegistry(ctx, serveDir)
+			if err != nil {
+				return err
+			}
+			defer reg.Close()
+
+			slog.Info("bundle loaded", "dir", serveDir, "repositories", len(reg.Repositories()))
+			return serve.ListenAndServe(ctx, serveListen, serveTLSCert, serveTLSKey, reg)
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVarP(&serveDir, "dir", "d", "", "Bundle directory (generate output) or OCI layout to serve")
+	flags.StringVarP(&serveListen, "listen", "l", ":5000", "Address to listen on")
+	flags.StringVar(&serveTLSCert, "tls-cert", "", "TLS certificate file to serve over HTTPS")
+	flags.StringVar(&serveTLSKey, "tls-key", "", "TLS key file to serve over HTTPS")
+
+	// Required flags
+	c.MarkFlagRequired("dir")
+
+	return c
+}
+
+func NewServeArtifactsCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "serve-artifacts",
+		Short: "Command to serve the RKE2 artifacts and install.sh over HTTP(S) for node bootstrapping",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Validate TLS flags
+			if (artifactsTLSCert == "") != (artifactsTLSKey == "") {
+				return fmt.Errorf("--tls-cert and --tls-key must be provided together")
+			}
+
+			files, err := serve.ArtifactFiles(artifactsDir)
+			if err != nil {
+				return err
+			}
+
+			baseURL := artifactsAdvertiseURL
+			if baseURL == "" {
+				if baseURL, err = defaultAdvertiseURL(artifactsListen, artifactsTLSCert != ""); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Run on every node to install RKE2 from this host:\n\n%s\n", serve.InstallInstructions(baseURL, files))
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return serve.ListenAndServe(ctx, artifactsListen, artifactsTLSCert, artifactsTLSKey, serve.NewArtifactsHandler(artifactsDir))
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVarP(&artifactsDir, "dir", "d", "", "Directory with the RKE2 artifacts (generate --output)")
+	flags.StringVarP(&artifactsListen, "listen", "l", ":8080", "Address to listen on")
+	flags.StringVar(&artifactsTLSCert, "tls-cert", "", "TLS certificate file to serve over HTTPS")
+	flags.StringVar(&artifactsTLSKey, "tls-key", "", "TLS key file to serve over HTTPS")
+	flags.StringVar(&artifactsAdvertiseURL, "advertise-url", "", "URL the nodes use to reach this server (default derived from --listen and the hostname)")
+
+	// Required flags
+	c.MarkFlagRequired("dir")
+
+	return c
+}
+
+// defaultAdvertiseURL builds the URL printed in the install instructions from the listen address
+func defaultAdvertiseURL(listen string, tls bool) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid value for --listen: %s: %v", listen, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		if host, err = os.Hostname(); err != nil {
+			return "", err
+		}
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port)), nil
+}
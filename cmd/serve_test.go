@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe_TLSCertWithoutKey_Error(t *testing.T) {
+	cmd := NewServeCommand()
+	cmd.SetArgs([]string{"--dir", t.TempDir(), "--tls-cert", "cert.pem"})
+	cmd.SilenceUsage = true
+
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--tls-cert and --tls-key")
+}
+
+func TestServe_NoImages_Error(t *testing.T) {
+	cmd := NewServeCommand()
+	cmd.SetArgs([]string{"--dir", t.TempDir()})
+	cmd.SilenceUsage = true
+
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no images found")
+}
+
+func TestServeArtifacts_MissingArtifacts_Error(t *testing.T) {
+	cmd := NewServeArtifactsCommand()
+	cmd.SetArgs([]string{"--dir", t.TempDir()})
+	cmd.SilenceUsage = true
+
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "run generate first")
+}
+
+func TestDefaultAdvertiseURL(t *testing.T) {
+	url, err := defaultAdvertiseURL("10.0.0.1:8080", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:8080", url)
+
+	_, err = defaultAdvertiseURL("8080", false)
+	assert.Error(t, err)
+}
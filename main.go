@@ -1,24 +1,34 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"os"
 
-	"github.com/TwiN/go-color"
 	"github.com/alknopfler/seactl/cmd"
+	"github.com/alknopfler/seactl/pkg/logger"
+	"github.com/alknopfler/seactl/pkg/progress"
+	"github.com/alknopfler/seactl/pkg/transport"
 	"github.com/spf13/cobra"
 )
 
 var version = "dev"
 
+var (
+	logLevel  string
+	logFormat string
+)
+
 func init() {
 
 }
 
 func main() {
 	command := newCommand()
-	if err := command.Execute(); err != nil {
-		log.Fatalf(color.InRed("[ERROR] %s"), err.Error())
+	err := command.Execute()
+	transport.Cleanup()
+	if err != nil {
+		slog.Error("command failed", "error", err)
+		os.Exit(1)
 	}
 }
 
@@ -32,17 +42,36 @@ func newCommand() *cobra.Command {
 			"- Save artifacts to a tarball\n" +
 			"- Login to a private registry\n" +
 			"- Upload and preload the private registry with the artifacts\n" +
+			"- Serve a bundle as a local read-only registry\n" +
+			"- Serve the RKE2 artifacts to bootstrap the nodes\n" +
+			"- Preflight checks before a long mirroring run\n" +
+			"- Declarative SeactlConfig file for repeatable runs\n" +
+			"- List the available release versions\n" +
+			"- Custom release sources: registry, local directory or web server\n" +
 			"\n",
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
 			os.Exit(0)
 		},
 		Version: version,
+		// Logs go to stderr, stdout is kept for the command output (run report, preflight results)
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return logger.Configure(logLevel, logFormat, progress.NewWriter(os.Stderr))
+		},
 	}
 
+	c.PersistentFlags().StringVar(&logLevel, "log-level", logger.DefaultLevel, "Log level: debug, info, warn or error")
+	c.PersistentFlags().StringVar(&logFormat, "log-format", logger.FormatText, "Log format: text or json, colors are disabled when stdout is not a terminal")
+
 	c.SetVersionTemplate("seactl version {{.Version}}\n")
 
 	c.AddCommand(cmd.NewAirGapCommand())
+	c.AddCommand(cmd.NewServeCommand())
+	c.AddCommand(cmd.NewServeArtifactsCommand())
+	c.AddCommand(cmd.NewRKE2Command())
+	c.AddCommand(cmd.NewPreflightCommand())
+	c.AddCommand(cmd.NewConfigCommand())
+	c.AddCommand(cmd.NewReleasesCommand())
 
 	return c
 }
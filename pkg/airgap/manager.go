@@ -1,17 +1,29 @@
 package airgap
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/TwiN/go-color"
 	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/download"
+	"github.com/alknopfler/seactl/pkg/filter"
 	"github.com/alknopfler/seactl/pkg/helm"
 	"github.com/alknopfler/seactl/pkg/images"
+	"github.com/alknopfler/seactl/pkg/k3s"
+	"github.com/alknopfler/seactl/pkg/progress"
 	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/report"
 	"github.com/alknopfler/seactl/pkg/rke2"
-	"log"
+	"github.com/google/go-containerregistry/pkg/name"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Manager interface {
@@ -31,136 +43,698 @@ var CheckHelmCommand = func() error {
 // ReadAirgapManifestFunc is assignable for testing
 var ReadAirgapManifestFunc = config.ReadAirgapManifest
 
-// GenerateAirGapEnvironment is assignable for testing
-var GenerateAirGapEnvironment = func(
-	dryrun bool,
-	releaseVersion, releaseMode,
-	registryURL, registryAuthFile, registryCACert,
-	outputDirTarball string,
-	insecure bool,
-) error {
-	fatalErrors := make(chan error)
-	wgDone := make(chan bool)
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	releaseManifest, imagesManifest, err := ReadAirgapManifestFunc(releaseVersion, releaseMode)
-	if err != nil {
-		return err
+// Kubernetes distributions whose artifacts can be generated
+const (
+	KubernetesRKE2 = "rke2"
+	KubernetesK3S  = "k3s"
+	KubernetesBoth = "both"
+)
+
+// Components of a generate run
+const (
+	ComponentImages = "images"
+	ComponentHelm   = "helm"
+	ComponentRKE2   = "rke2"
+	ComponentK3S    = "k3s"
+)
+
+// Distributions lists the values of Options.Kubernetes
+var Distributions = []string{KubernetesRKE2, KubernetesK3S, KubernetesBoth}
+
+// ValidateKubernetes returns an error if kubernetes is not one of Distributions
+func ValidateKubernetes(kubernetes string) error {
+	if !slices.Contains(Distributions, kubernetes) {
+		return fmt.Errorf("unknown distribution %q, allowed: %s", kubernetes, strings.Join(Distributions, ", "))
 	}
+	return nil
+}
 
-	reg := registry.New(registryAuthFile, registryURL, registryCACert, insecure)
+// Components lists the components a run can select
+var Components = []string{ComponentImages, ComponentHelm, ComponentRKE2, ComponentK3S}
 
-	go func() {
-		err := generateRKE2Artifacts(dryrun, releaseManifest, outputDirTarball)
-		if err != nil {
-			fatalErrors <- err
+// ValidateComponents returns an error if components is empty or holds an unknown component
+func ValidateComponents(components []string) error {
+	if len(components) == 0 {
+		return errors.New("no component selected")
+	}
+	for _, c := range components {
+		if !slices.Contains(Components, c) {
+			return fmt.Errorf("unknown component %q, allowed: %s", c, strings.Join(Components, ", "))
 		}
-		wg.Done()
-	}()
+	}
+	return nil
+}
 
-	go func() {
-		err = generateHelmArtifacts(dryrun, releaseManifest, reg)
+// DefaultComponents returns the components of a run not selecting them: the images, the helm charts and the
+// artifacts of the kubernetes distribution (KubernetesRKE2 when empty)
+func DefaultComponents(kubernetes string) []string {
+	components := []string{ComponentImages, ComponentHelm}
+	switch kubernetes {
+	case KubernetesK3S:
+		return append(components, ComponentK3S)
+	case KubernetesBoth:
+		return append(components, ComponentRKE2, ComponentK3S)
+	default:
+		return append(components, ComponentRKE2)
+	}
+}
+
+// ValidateConfig returns all the errors of the config file fields checked against the values of this package
+// and of the report and rke2 ones, the other fields being checked by config.SeactlConfig.Validate
+func ValidateConfig(c *config.SeactlConfig) error {
+	var errs []error
+	check := func(field string, err error) {
 		if err != nil {
-			fatalErrors <- err
+			errs = append(errs, fmt.Errorf("%s: %v", field, err))
 		}
-		wg.Done()
-	}()
+	}
+
+	if len(c.Components) > 0 {
+		check("components", ValidateComponents(c.Components))
+	}
+	if f := c.Output.Report.Format; f != "" {
+		check("output.report.format", report.ValidateFormat(f))
+	}
+	if d := c.Kubernetes.Distribution; d != "" {
+		check("kubernetes.distribution", ValidateKubernetes(d))
+	}
+	check("kubernetes.rke2.cnis", rke2.ValidateCNIs(c.Kubernetes.RKE2.CNIs))
+	if u := c.Kubernetes.RKE2.ReleaseURL; u != "" {
+		check("kubernetes.rke2.releaseURL", rke2.ValidateURLTemplate(u))
+	}
+	if u := c.Kubernetes.RKE2.InstallURL; u != "" {
+		check("kubernetes.rke2.installURL", rke2.ValidateURLTemplate(u))
+	}
+	return errors.Join(errs...)
+}
+
+// UsesHelm reports whether a run with components calls helm: to mirror the charts, or to render them when
+// the images are selected with chartImages
+func UsesHelm(components []string, chartImages bool) bool {
+	return slices.Contains(components, ComponentHelm) || (slices.Contains(components, ComponentImages) && chartImages)
+}
+
+// Options holds the settings of a generate run
+type Options struct {
+	DryRun           bool
+	ReleaseVersion   string
+	ReleaseMode      string
+	RegistryURL      string
+	RegistryAuthFile string
+	RegistryCACert   string
+	RegistryInsecure bool
+	RegistryCert     string // client certificate for registries requiring mutual TLS
+	RegistryKey      string // client key for registries requiring mutual TLS
+	OutputDirTarball string
+	OutputOCILayout  string             // optional OCI image-layout directory where the images are also written
+	ImagesArchive    string             // optional docker-archive format ("tar" or "tar.zst") to pack the images in OutputDirTarball
+	ArchiveMaxImages int                // max images per docker-archive, 0 means a single archive
+	RKE2Upload       bool               // push the RKE2 artifacts to the registry as OCI artifacts
+	RKE2ImagesUpload bool               // push the images inside the rke2-images tarballs to the registry
+	RKE2CNIs         []string           // only fetch the core RKE2 archive plus these CNI archives (all of them when empty)
+	RKE2ReleaseURL   string             // RKE2 release files base URL or URL template, rke2.RKE2ReleaseURL when empty
+	RKE2InstallURL   string             // RKE2 install.sh URL or URL template, rke2.RKE2URL when empty
+	Kubernetes       string             // KubernetesRKE2 (default), KubernetesK3S or KubernetesBoth, when Components is empty
+	Components       []string           // components of the run, DefaultComponents(Kubernetes) when empty
+	ReportFormat     string             // run report format written to OutputDirTarball: report.FormatJSON (default) or report.FormatYAML
+	ReportStdout     bool               // also print the run report to stdout
+	Concurrency      int                // images mirrored in parallel, 1 when not set
+	Rewrites         []registry.Rewrite // rewrite rules of the image repositories in the registry
+	Filters          Filters            // images and charts selected for the run, all of them when empty
+	Additions        *config.Additions  // images and charts mirrored on top of the release manifest ones
+}
+
+// HasComponent reports whether the run includes component
+func (o Options) HasComponent(component string) bool {
+	components := o.Components
+	if len(components) == 0 {
+		components = DefaultComponents(o.Kubernetes)
+	}
+	return slices.Contains(components, component)
+}
+
+// Filters select the images and charts of a run
+type Filters struct {
+	Images      *filter.Filter // on the image references of the images manifest
+	Charts      *filter.Filter // on the helm release names
+	ChartImages bool           // only the images referenced by the selected charts
+}
+
+// GenerateAirGapEnvironment is assignable for testing
+var GenerateAirGapEnvironment = func(opts Options) error {
+	rep := report.New(opts.ReleaseVersion, opts.ReleaseMode, opts.RegistryURL, opts.DryRun)
+
+	releaseManifest, imagesManifest, err := ReadAirgapManifestFunc(opts.ReleaseVersion, opts.ReleaseMode)
+	if err != nil {
+		rep.AddError(err)
+		return failRun(opts, rep, err)
+	}
+	if opts.Additions != nil {
+		addedImages, addedCharts := opts.Additions.Merge(releaseManifest, imagesManifest)
+		slog.Info("additional images and charts merged into the release", "images", addedImages, "charts", addedCharts)
+	}
+
+	reg := registry.New(opts.RegistryAuthFile, opts.RegistryURL, opts.RegistryCACert, opts.RegistryInsecure)
+	reg.RegistryClientCert = opts.RegistryCert
+	reg.RegistryClientKey = opts.RegistryKey
+	reg.Rewrites = opts.Rewrites
+
+	// Every image and chart is an item, the RKE2 and K3s artifacts are one item each
+	var tasks []func(ctx context.Context) error
+	items := 0
+	if opts.HasComponent(ComponentHelm) {
+		tasks = append(tasks, func(ctx context.Context) error { return generateHelmArtifacts(ctx, opts, releaseManifest, reg, rep) })
+		items += len(releaseManifest.Spec.Components.Workloads.Helm)
+	}
+	if opts.HasComponent(ComponentImages) {
+		tasks = append(tasks, func(ctx context.Context) error {
+			return generateImagesArtifacts(ctx, opts, releaseManifest, imagesManifest, reg, rep)
+		})
+		items += len(imagesManifest.Images)
+	}
+	if opts.HasComponent(ComponentRKE2) {
+		tasks = append(tasks, func(ctx context.Context) error { return generateRKE2Artifacts(ctx, opts, releaseManifest, reg, rep) })
+		items++
+	}
+	if opts.HasComponent(ComponentK3S) {
+		tasks = append(tasks, func(ctx context.Context) error { return generateK3SArtifacts(ctx, opts, releaseManifest, rep) })
+		items++
+	}
+
+	tracker := progress.Default()
+	tracker.AddItems(items)
+	tracker.Start()
+	defer tracker.Stop()
+
+	if err := runTasks(tasks, rep); err != nil {
+		slog.Error("generate run aborted", "error", err)
+		return failRun(opts, rep, err)
+	}
+	return writeReport(opts, rep)
+}
+
+// runTasks runs the tasks in parallel and returns the first error. The other tasks are then cancelled and
+// waited for, so nothing is pushed or downloaded, nor added to the report, once the run is aborted.
+func runTasks(tasks []func(ctx context.Context) error, rep *report.Report) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	wg.Add(len(tasks))
+	for _, task := range tasks {
+		go func(task func(ctx context.Context) error) {
+			defer wg.Done()
+			err := task(ctx)
+			// a task stopped by the cancellation is not an error of its own
+			if err == nil || (errors.Is(err, context.Canceled) && ctx.Err() != nil) {
+				return
+			}
+			rep.AddError(err)
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+			mu.Unlock()
+		}(task)
+	}
+	wg.Wait()
+	return firstErr
+}
 
-	go func() {
-		err = generateImagesArtifacts(dryrun, imagesManifest, reg)
+// reportStdout is assignable for testing
+var reportStdout io.Writer = os.Stdout
+
+// writeReport writes the run report to the output directory if any, and to stdout when asked to
+func writeReport(opts Options, rep *report.Report) error {
+	rep.Finish()
+
+	format := opts.ReportFormat
+	if format == "" {
+		format = report.FormatJSON
+	}
+	if opts.OutputDirTarball != "" {
+		path, err := rep.Write(opts.OutputDirTarball, format)
 		if err != nil {
-			fatalErrors <- err
+			return err
 		}
-		wg.Done()
-	}()
+		slog.Info("run report written", "path", path)
+	} else {
+		slog.Warn("no output directory, the run report is not written")
+	}
 
-	go func() {
-		wg.Wait()
-		close(wgDone)
-	}()
+	if opts.ReportStdout {
+		return rep.Encode(reportStdout, format)
+	}
+	return nil
+}
 
-	select {
-	case <-wgDone:
-		return nil
-	case err = <-fatalErrors:
-		close(fatalErrors)
-		log.Fatal("Error found running the program: ", err)
-		return err
+// failRun writes the report of a failed run and returns the error that aborted it
+func failRun(opts Options, rep *report.Report, err error) error {
+	if reportErr := writeReport(opts, rep); reportErr != nil {
+		slog.Error("failed to write the run report", "error", reportErr)
 	}
+	return err
 }
 
-func generateRKE2Artifacts(dryrun bool, airgapManifest *config.ReleaseManifest, outputDirTarball string) error {
-	r := rke2.New(airgapManifest.Spec.Components.Kubernetes.Rke2.Version, outputDirTarball)
-	if !dryrun {
+func generateRKE2Artifacts(ctx context.Context, opts Options, airgapManifest *config.ReleaseManifest, reg *registry.Registry, rep *report.Report) error {
+	r := rke2.New(airgapManifest.Spec.Components.Kubernetes.Rke2.Version, opts.OutputDirTarball, reg)
+	r.CNIs = opts.RKE2CNIs
+	if opts.RKE2ReleaseURL != "" {
+		r.ReleaseURL = opts.RKE2ReleaseURL
+	}
+	if opts.RKE2InstallURL != "" {
+		r.InstallURL = opts.RKE2InstallURL
+	}
+	if !opts.DryRun {
 		if err := r.Download(); err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := r.Verify(); err != nil {
 			return err
 		}
+		slog.Info("RKE2 artifacts downloaded and verified", "version", r.Version, "dir", opts.OutputDirTarball)
 	} else {
-		log.Println("Dry run mode enabled, skipping download and verification of RKE2 images.")
+		slog.Info("dry run, skipping the download and verification of the RKE2 artifacts", "version", r.Version)
 	}
-	log.Println(color.InGreen("RKE2 Images downloaded and verified successfully! you can find them in: " + outputDirTarball))
-	return nil
-}
+	addFiles(rep, KubernetesRKE2, r.OutputDirTarball, r.ChecksumsFile(), r.Files(), opts.DryRun)
+	progress.Default().ItemDone()
 
-func generateHelmArtifacts(dryrun bool, releaseManifest *config.ReleaseManifest, reg *registry.Registry) error {
-	for _, value := range releaseManifest.Spec.Components.Workloads.Helm {
-		h := helm.New(value.ReleaseName, value.Version, value.Chart, value.Repository, reg)
-		if !dryrun {
-			if err := reg.RegistryHelmLogin(); err != nil {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if opts.RKE2Upload && reg.RegistryURL != "" {
+		if opts.DryRun {
+			slog.Info("dry run, RKE2 artifacts would be pushed", "target", reg.RegistryURL+"/"+rke2.ArtifactRepository)
+		} else {
+			if err := r.Upload(); err != nil {
 				return err
 			}
-			if err := h.Download(); err != nil {
+			slog.Info("RKE2 artifacts pushed to the registry", "registry", reg.RegistryURL)
+		}
+	}
+
+	if opts.RKE2ImagesUpload && reg.RegistryURL != "" {
+		if opts.DryRun {
+			slog.Info("dry run, RKE2 images would be pushed", "archives", r.ImageArchives(), "registry", reg.RegistryURL)
+		} else {
+			if err := uploadRKE2Images(ctx, r.ImageArchives(), reg, rep); err != nil {
 				return err
 			}
-			if err := h.Verify(); err != nil {
-				return err
+			slog.Info("RKE2 images pre-loaded in the registry", "registry", reg.RegistryURL)
+		}
+	}
+	return nil
+}
+
+// uploadRKE2Images loads every image of the rke2-images docker-archives and pushes it to the registry
+// through the same upload path as the release images
+func uploadRKE2Images(ctx context.Context, archives []string, reg *registry.Registry, rep *report.Report) error {
+	if err := reg.RegistryLogin(); err != nil {
+		return err
+	}
+
+	// The all-in-one rke2-images archive overlaps with the core and CNI ones
+	pushed := map[string]bool{}
+	for _, archive := range archives {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		imgs, cleanup, err := images.LoadArchive(archive, reg)
+		if err != nil {
+			return err
+		}
+		for _, img := range imgs {
+			if pushed[img.Name] {
+				continue
 			}
-			if reg.RegistryInsecure {
-				h.Insecure = true
+			if err := ctx.Err(); err != nil {
+				cleanup()
+				return err
 			}
-			if err := h.Upload(); err != nil {
+			start := time.Now()
+			err := img.Upload()
+			rep.AddImage(imageEntry(img, reg, start, err))
+			if err != nil {
+				cleanup()
 				return err
 			}
-			log.Printf(color.InGreen("Helm chart %s prepared and uploaded successfully!\n"), value.ReleaseName)
-		} else {
-			log.Println("DryRun mode - Helm Chart Info:")
-			log.Printf("\nName: %s\nVersion: %s\nURL: %s\nChart: %s\n", h.Name, h.Version, h.URL, h.Chart)
+			pushed[img.Name] = true
 		}
+		cleanup()
 	}
-	log.Println(color.InGreen("Helm Chart artifacts pre-loaded in registry successfully!"))
+	slog.Info("RKE2 images pushed", "images", len(pushed), "registry", reg.RegistryURL)
 	return nil
 }
 
-func generateImagesArtifacts(dryrun bool, imagesManifest *config.ImagesManifest, reg *registry.Registry) error {
-	for _, value := range imagesManifest.Images {
-		img := images.New(value.Name, reg)
-		if !dryrun {
-			if err := reg.RegistryLogin(); err != nil {
+func generateK3SArtifacts(ctx context.Context, opts Options, releaseManifest *config.ReleaseManifest, rep *report.Report) error {
+	outputDir := filepath.Join(opts.OutputDirTarball, k3s.OutputSubDir)
+	k := k3s.New(releaseManifest.Spec.Components.Kubernetes.K3S.Version, outputDir)
+	if !opts.DryRun {
+		if err := k.Download(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := k.Verify(); err != nil {
+			return err
+		}
+		slog.Info("K3s artifacts downloaded and verified", "version", k.Version, "dir", outputDir)
+	} else {
+		slog.Info("dry run, skipping the download and verification of the K3s artifacts", "version", k.Version)
+	}
+	addFiles(rep, KubernetesK3S, outputDir, k.ChecksumsFile(), k.Files(), opts.DryRun)
+	progress.Default().ItemDone()
+	return nil
+}
+
+func generateHelmArtifacts(ctx context.Context, opts Options, releaseManifest *config.ReleaseManifest, reg *registry.Registry, rep *report.Report) error {
+	var charts []*helm.Helm
+	for _, value := range releaseManifest.Spec.Components.Workloads.Helm {
+		h := helm.New(value.ReleaseName, value.Version, value.Chart, value.Repository, reg)
+		if ok, reason := opts.Filters.Charts.Match(h.Name); !ok {
+			entry := chartEntry(h, time.Now(), nil)
+			entry.Status, entry.Target, entry.Reason = report.StatusFiltered, "", reason
+			rep.AddChart(entry)
+			progress.Default().ItemDone()
+			slog.Info("helm chart filtered out", "chart", h.Name, "reason", reason)
+			continue
+		}
+		charts = append(charts, h)
+	}
+
+	if reg.RegistryURL == "" {
+		slog.Warn("no registry URL provided, skipping the helm charts")
+		for _, h := range charts {
+			entry := chartEntry(h, time.Now(), nil)
+			entry.Status, entry.Target, entry.Reason = report.StatusSkipped, "", "no registry URL"
+			rep.AddChart(entry)
+			progress.Default().ItemDone()
+		}
+		return nil
+	}
+	// A single helm registry login for all the charts
+	if !opts.DryRun && len(charts) > 0 {
+		if err := reg.RegistryHelmLogin(); err != nil {
+			return err
+		}
+	}
+	for _, h := range charts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := time.Now()
+		if !opts.DryRun {
+			err := mirrorChart(h, reg)
+			entry := chartEntry(h, start, err)
+			rep.AddChart(entry)
+			progress.Default().ItemDone()
+			if err != nil {
 				return err
 			}
-			if err := img.Download(); err != nil {
-				return err
+			slog.Info("helm chart mirrored", "chart", h.Name, "version", h.Version, "target", entry.Target)
+		} else {
+			entry := chartEntry(h, start, nil)
+			entry.Status = report.StatusDryRun
+			rep.AddChart(entry)
+			progress.Default().ItemDone()
+			slog.Info("dry run, helm chart would be mirrored", "chart", h.Name, "version", h.Version, "repository", h.URL, "source", h.Chart)
+		}
+	}
+	slog.Info("helm charts pre-loaded in the registry", "registry", reg.RegistryURL)
+	return nil
+}
+
+// mirrorChart pulls the chart and pushes it to the registry
+func mirrorChart(h *helm.Helm, reg *registry.Registry) error {
+	if err := h.Download(); err != nil {
+		return err
+	}
+	if err := h.Verify(); err != nil {
+		return err
+	}
+	if reg.RegistryInsecure {
+		h.Insecure = true
+	}
+	return h.Upload()
+}
+
+func generateImagesArtifacts(ctx context.Context, opts Options, releaseManifest *config.ReleaseManifest, imagesManifest *config.ImagesManifest, reg *registry.Registry, rep *report.Report) error {
+	selected, err := selectImages(opts, releaseManifest, imagesManifest, reg, rep)
+	if err != nil {
+		return err
+	}
+
+	// The registry is checked once, then every push shares its transport and credentials
+	if !opts.DryRun && reg.RegistryURL != "" {
+		if err := reg.RegistryLogin(); err != nil {
+			return err
+		}
+	}
+
+	// The images are mirrored by opts.Concurrency workers, the archives keep the manifest order
+	pulled := make([]*images.Images, len(selected))
+	err = forEach(ctx, len(selected), opts.Concurrency, func(idx int) error {
+		img := images.New(selected[idx], reg)
+		start := time.Now()
+		if opts.DryRun {
+			entry := imageEntry(img, reg, start, nil)
+			entry.Status = report.StatusDryRun
+			rep.AddImage(entry)
+			progress.Default().ItemDone()
+			slog.Info("dry run, image would be mirrored", "image", img.Name, "target", entry.Target)
+			return nil
+		}
+		err := mirrorImage(opts, img, reg)
+		rep.AddImage(imageEntry(img, reg, start, err))
+		progress.Default().ItemDone()
+		if err != nil {
+			return err
+		}
+		pulled[idx] = img
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.ImagesArchive != "" {
+		if opts.DryRun {
+			slog.Info("dry run, images archives would be written", "archives", images.ArchiveNames(len(selected), opts.ArchiveMaxImages, opts.ImagesArchive))
+		} else {
+			var archived []*images.Images
+			for _, img := range pulled {
+				if img != nil {
+					archived = append(archived, img)
+				}
 			}
-			if err := img.Verify(); err != nil {
+			if _, err := images.WriteArchives(archived, opts.OutputDirTarball, opts.ImagesArchive, opts.ArchiveMaxImages); err != nil {
 				return err
 			}
-			if reg.RegistryInsecure {
-				img.Insecure = true
-			}
-			fmt.Println("Image Info:")
-			fmt.Printf("Name: %s\n", img.Name)
-			if err := img.Upload(); err != nil {
-				return err
+			slog.Info("images archives written", "dir", opts.OutputDirTarball)
+		}
+	}
+	if opts.OutputOCILayout != "" {
+		slog.Info("images written to the OCI layout", "layout", opts.OutputOCILayout)
+	}
+	if reg.RegistryURL != "" {
+		slog.Info("images pre-loaded in the registry", "registry", reg.RegistryURL)
+	}
+	return nil
+}
+
+// selectImages returns the images of the manifest selected by the filters, the other ones are recorded as
+// filtered out
+func selectImages(opts Options, releaseManifest *config.ReleaseManifest, imagesManifest *config.ImagesManifest, reg *registry.Registry, rep *report.Report) ([]string, error) {
+	var chartImages map[string]bool
+	if opts.Filters.ChartImages {
+		var err error
+		if chartImages, err = chartImageRepositories(opts, releaseManifest, reg); err != nil {
+			return nil, err
+		}
+	}
+
+	var selected []string
+	for _, value := range imagesManifest.Images {
+		ok, reason := opts.Filters.Images.Match(value.Name)
+		if ok && chartImages != nil && !chartImages[repositoryName(value.Name)] {
+			ok, reason = false, "not referenced by the selected charts"
+		}
+		if !ok {
+			rep.AddImage(report.Image{Source: value.Name, Status: report.StatusFiltered, Reason: reason})
+			progress.Default().ItemDone()
+			slog.Info("image filtered out", "image", value.Name, "reason", reason)
+			continue
+		}
+		selected = append(selected, value.Name)
+	}
+	return selected, nil
+}
+
+// chartImageRepositories renders the charts selected by the filters and returns the repositories of the
+// images they reference, the tags being ignored as the charts may pin them differently than the manifest
+func chartImageRepositories(opts Options, releaseManifest *config.ReleaseManifest, reg *registry.Registry) (map[string]bool, error) {
+	repositories := map[string]bool{}
+	for _, value := range releaseManifest.Spec.Components.Workloads.Helm {
+		if ok, _ := opts.Filters.Charts.Match(value.ReleaseName); !ok {
+			continue
+		}
+		h := helm.New(value.ReleaseName, value.Version, value.Chart, value.Repository, reg)
+		imgs, err := chartImages(h)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range imgs {
+			repositories[repositoryName(img)] = true
+		}
+		slog.Debug("chart images listed", "chart", h.Name, "version", h.Version, "images", len(imgs))
+	}
+	return repositories, nil
+}
+
+// chartImages is assignable for testing
+var chartImages = func(h *helm.Helm) ([]string, error) {
+	return h.Images()
+}
+
+// repositoryName returns the normalized repository of image, e.g. index.docker.io/library/nginx for nginx:1.27
+func repositoryName(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+	return ref.Context().Name()
+}
+
+// forEach calls fn for the indexes 0 to n-1 from the given number of workers (at least one), no new call
+// starts once one failed or ctx is cancelled and the first error is returned
+func forEach(ctx context.Context, n, workers int, fn func(idx int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				if err := fn(idx); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
 			}
-		} else {
-			log.Println("DryRun mode - Image Info:")
-			log.Printf("\nName: %s\n", img.Name)
+		}()
+	}
+
+	for idx := 0; idx < n && !failed() && ctx.Err() == nil; idx++ {
+		next <- idx
+	}
+	close(next)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// mirrorImage pulls the image and writes it to the registry and the OCI layout, the docker-archives are
+// written once every image is pulled
+func mirrorImage(opts Options, img *images.Images, reg *registry.Registry) error {
+	if err := img.Download(); err != nil {
+		return err
+	}
+	if err := img.Verify(); err != nil {
+		return err
+	}
+	if reg.RegistryURL != "" {
+		if err := img.Upload(); err != nil {
+			return err
+		}
+	}
+	if opts.OutputOCILayout != "" {
+		if err := img.SaveToLayout(opts.OutputOCILayout); err != nil {
+			return err
 		}
 	}
-	log.Println(color.InGreen("Images artifacts pre-loaded in registry successfully!"))
 	return nil
 }
+
+// imageEntry returns the report entry of an image processed since start, err being its processing error
+func imageEntry(img *images.Images, reg *registry.Registry, start time.Time, err error) report.Image {
+	entry := report.Image{Source: img.Name, Status: report.StatusOK, Duration: report.Since(start)}
+	if reg.RegistryURL != "" {
+		entry.Target, _ = img.TargetReference()
+	}
+	if img.ImageRef != nil {
+		entry.Digest, _ = img.Digest()
+		entry.Size, _ = img.Size()
+	}
+	if err != nil {
+		entry.Status, entry.Error = report.StatusFailed, err.Error()
+	}
+	return entry
+}
+
+// chartEntry returns the report entry of a chart processed since start, err being its processing error
+func chartEntry(h *helm.Helm, start time.Time, err error) report.Chart {
+	entry := report.Chart{
+		Name:       h.Name,
+		Chart:      h.Chart,
+		Version:    h.Version,
+		Repository: h.URL,
+		Target:     h.TargetReference(),
+		Status:     report.StatusOK,
+		Duration:   report.Since(start),
+	}
+	if err != nil {
+		entry.Status, entry.Error = report.StatusFailed, err.Error()
+	}
+	return entry
+}
+
+// addFiles records the downloaded files of a Kubernetes distribution with their install.sh, the checksums
+// come from the release checksums file the files were verified against
+func addFiles(rep *report.Report, component, dir, checksumsFile string, files []string, dryRun bool) {
+	checksums, _ := download.ReadChecksums(filepath.Join(dir, checksumsFile))
+	for _, file := range append([]string{"install.sh"}, files...) {
+		entry := report.File{Component: component, Name: file, Path: filepath.Join(dir, file), Status: report.StatusOK}
+		if dryRun {
+			entry.Status = report.StatusDryRun
+			rep.AddFile(entry)
+			continue
+		}
+		if info, err := os.Stat(entry.Path); err == nil {
+			entry.Size = info.Size()
+		}
+		if sum, ok := checksums[file]; ok {
+			entry.SHA256 = sum
+		} else {
+			// install.sh and the checksums file itself are not listed
+			entry.SHA256, _ = download.FileSHA256(entry.Path)
+		}
+		rep.AddFile(entry)
+	}
+}
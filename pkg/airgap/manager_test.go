@@ -1,43 +1,40 @@
 package airgap
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
 	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/filter"
+	"github.com/alknopfler/seactl/pkg/helm"
+	"github.com/alknopfler/seactl/pkg/images"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/report"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"github.com/stretchr/testify/require"
 )
 
 func fakeReleaseManifest() (*config.ReleaseManifest, *config.ImagesManifest, error) {
 	manifest := &config.ReleaseManifest{}
-	manifest.Spec.Components.Workloads.Helm = []struct {
-		PrettyName  string "yaml:\"prettyName\""
-		ReleaseName string "yaml:\"releaseName\""
-		Chart       string "yaml:\"chart\""
-		Version     string "yaml:\"version\""
-		Repository  string "yaml:\"repository,omitempty\""
-		Values      struct {
-			PostDelete struct {
-				Enabled bool "yaml:\"enabled\""
-			} "yaml:\"postDelete\""
-		} "yaml:\"values,omitempty\""
-		DependencyCharts []struct {
-			ReleaseName string "yaml:\"releaseName\""
-			Chart       string "yaml:\"chart\""
-			Version     string "yaml:\"version\""
-			Repository  string "yaml:\"repository\""
-		} "yaml:\"dependencyCharts,omitempty\""
-		AddonCharts []struct {
-			ReleaseName string "yaml:\"releaseName\""
-			Chart       string "yaml:\"chart\""
-			Version     string "yaml:\"version\""
-		} "yaml:\"addonCharts,omitempty\""
-	}{{ReleaseName: "test-chart", Chart: "oci://test/chart", Version: "1.0.0"}}
-
-	imagesManifest := &config.ImagesManifest{
-		Images: []struct {
-			Name string `yaml:"name"`
-		}{{Name: "test-image"}},
-	}
+	manifest.Spec.Components.Workloads.Helm = []config.HelmWorkload{{ReleaseName: "test-chart", Chart: "oci://test/chart", Version: "1.0.0"}}
+
+	imagesManifest := &config.ImagesManifest{Images: []config.Image{{Name: "test-image"}}}
 
 	return manifest, imagesManifest, nil
 }
@@ -47,14 +44,449 @@ func TestGenerateAirGapEnvironment_DryRun(t *testing.T) {
 		return fakeReleaseManifest()
 	}
 
-	err := GenerateAirGapEnvironment(true, "v1.0.0", "factory", "url", "auth", "ca", "/tmp", true)
+	err := GenerateAirGapEnvironment(Options{
+		DryRun: true, ReleaseVersion: "v1.0.0", ReleaseMode: "factory",
+		RegistryURL: "url", RegistryAuthFile: "auth", RegistryCACert: "ca",
+		OutputDirTarball: t.TempDir(), RegistryInsecure: true,
+	})
+	assert.NoError(t, err)
+}
+
+func TestGenerateAirGapEnvironment_DryRunK3S(t *testing.T) {
+	ReadAirgapManifestFunc = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		return fakeReleaseManifest()
+	}
+
+	err := GenerateAirGapEnvironment(Options{
+		DryRun: true, ReleaseVersion: "v1.0.0", ReleaseMode: "factory",
+		RegistryURL: "url", OutputDirTarball: t.TempDir(), Kubernetes: KubernetesBoth,
+	})
 	assert.NoError(t, err)
 }
 
+func TestGenerateRKE2Artifacts_DryRunUploads(t *testing.T) {
+	var logs bytes.Buffer
+	orig := slog.Default()
+	defer slog.SetDefault(orig)
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	manifest := &config.ReleaseManifest{}
+	manifest.Spec.Components.Kubernetes.Rke2.Version = "v1.30.3+rke2r1"
+	reg := registry.New("", "registry.local:5000", "", false)
+	rep := report.New("3.1.0", "factory", reg.RegistryURL, true)
+
+	err := generateRKE2Artifacts(context.Background(), Options{DryRun: true, OutputDirTarball: t.TempDir(), RKE2Upload: true, RKE2ImagesUpload: true}, manifest, reg, rep)
+	require.NoError(t, err)
+
+	// both uploads are reported, and nothing claims to be downloaded
+	assert.Contains(t, logs.String(), "dry run, RKE2 artifacts would be pushed")
+	assert.Contains(t, logs.String(), "dry run, RKE2 images would be pushed")
+	assert.NotContains(t, logs.String(), "downloaded and verified")
+}
+
 func TestGenerateAirGapEnvironment_ErrorFromManifest(t *testing.T) {
 	ReadAirgapManifestFunc = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
 		return nil, nil, errors.New("failed manifest")
 	}
-	err := GenerateAirGapEnvironment(true, "v1.0.0", "factory", "auth", "auth", "ca", "/tmp", true)
+	err := GenerateAirGapEnvironment(Options{
+		DryRun: true, ReleaseVersion: "v1.0.0", ReleaseMode: "factory",
+		RegistryURL: "auth", RegistryAuthFile: "auth", RegistryCACert: "ca",
+		OutputDirTarball: t.TempDir(), RegistryInsecure: true,
+	})
+	assert.Error(t, err)
+}
+
+func TestGenerateAirGapEnvironment_Report(t *testing.T) {
+	ReadAirgapManifestFunc = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		return fakeReleaseManifest()
+	}
+	var stdout bytes.Buffer
+	reportStdout = &stdout
+	defer func() { reportStdout = os.Stdout }()
+
+	dir := t.TempDir()
+	err := GenerateAirGapEnvironment(Options{
+		DryRun: true, ReleaseVersion: "3.1.0", ReleaseMode: "factory",
+		RegistryURL: "registry.local:5000", OutputDirTarball: dir, ReportStdout: true,
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, "seactl-report.json"))
+	require.NoError(t, err)
+	assert.Equal(t, string(data), stdout.String())
+
+	var rep report.Report
+	require.NoError(t, json.Unmarshal(data, &rep))
+	assert.Equal(t, report.StatusOK, rep.Status)
+	assert.Equal(t, 1, rep.Totals.Images)
+	assert.Equal(t, "registry.local:5000/library/test-image:latest", rep.Images[0].Target)
+	assert.Equal(t, report.StatusDryRun, rep.Images[0].Status)
+	// pushed under the chart name, not the release name
+	assert.Equal(t, "oci://registry.local:5000/chart:1.0.0", rep.Charts[0].Target)
+	assert.NotEmpty(t, rep.Files)
+	assert.Equal(t, "rke2", rep.Files[0].Component)
+}
+
+func TestGenerateAirGapEnvironment_ReportOnError(t *testing.T) {
+	ReadAirgapManifestFunc = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		return nil, nil, errors.New("failed manifest")
+	}
+
+	dir := t.TempDir()
+	err := GenerateAirGapEnvironment(Options{
+		DryRun: true, ReleaseVersion: "3.1.0", ReleaseMode: "factory",
+		OutputDirTarball: dir, ReportFormat: report.FormatYAML,
+	})
 	assert.Error(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, "seactl-report.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "status: failed")
+	assert.Contains(t, string(data), "- failed manifest")
+}
+
+func TestAddFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "install.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "k3s"), []byte("binary"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sha256sum-amd64.txt"), []byte("abc123  k3s\n"), 0644))
+
+	rep := report.New("3.1.0", "factory", "", false)
+	addFiles(rep, KubernetesK3S, dir, "sha256sum-amd64.txt", []string{"k3s", "sha256sum-amd64.txt"}, false)
+
+	require.Len(t, rep.Files, 3)
+	assert.Equal(t, "install.sh", rep.Files[0].Name)
+	assert.Len(t, rep.Files[0].SHA256, 64)
+	assert.Equal(t, "abc123", rep.Files[1].SHA256)
+	assert.Equal(t, int64(6), rep.Files[1].Size)
+	assert.Equal(t, report.StatusOK, rep.Files[2].Status)
+}
+
+func TestUploadRKE2Images(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	authFile := filepath.Join(t.TempDir(), "auth")
+	require.NoError(t, os.WriteFile(authFile, []byte("dXNlcg==:cGFzc3dvcmQ="), 0600))
+	reg := registry.New(authFile, strings.TrimPrefix(server.URL, "http://"), "", false)
+
+	// The same image in two archives is pushed once
+	dir := t.TempDir()
+	ri, err := random.Image(256, 1)
+	require.NoError(t, err)
+	img := images.New("docker.io/rancher/hardened-etcd:v3.5", reg)
+	img.ImageRef = ri
+	var archives []string
+	for _, sub := range []string{"all", "core"} {
+		paths, err := images.WriteArchives([]*images.Images{img}, filepath.Join(dir, sub), images.ArchiveFormatTarZstd, 0)
+		require.NoError(t, err)
+		archives = append(archives, paths...)
+	}
+
+	rep := report.New("3.1.0", "factory", reg.RegistryURL, false)
+	require.NoError(t, uploadRKE2Images(context.Background(), archives, reg, rep))
+	require.Len(t, rep.Images, 1)
+	assert.Equal(t, reg.RegistryURL+"/rancher/hardened-etcd:v3.5", rep.Images[0].Target)
+	assert.Equal(t, report.StatusOK, rep.Images[0].Status)
+
+	pushed, err := remote.Image(mustParseReference(t, reg.RegistryURL+"/rancher/hardened-etcd:v3.5"))
+	require.NoError(t, err)
+	want, _ := ri.Digest()
+	got, _ := pushed.Digest()
+	assert.Equal(t, want, got)
+	assert.Equal(t, want.String(), rep.Images[0].Digest)
+}
+
+func mustParseReference(t *testing.T, ref string) name.Reference {
+	t.Helper()
+	r, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	return r
+}
+
+func TestForEach(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[int]bool{}
+	err := forEach(context.Background(), 20, 4, func(idx int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[idx] = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, seen, 20)
+
+	// no new call starts after the first error
+	var calls int32
+	err = forEach(context.Background(), 100, 1, func(idx int) error {
+		atomic.AddInt32(&calls, 1)
+		if idx == 2 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "boom")
+	assert.LessOrEqual(t, atomic.LoadInt32(&calls), int32(4))
+
+	// nothing starts once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	err = forEach(ctx, 10, 2, func(idx int) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, atomic.LoadInt32(&calls))
+}
+
+func TestRunTasks_CancelsOnFirstError(t *testing.T) {
+	rep := report.New("3.1.0", "factory", "", false)
+	var stopped atomic.Bool
+	err := runTasks([]func(ctx context.Context) error{
+		func(ctx context.Context) error { return errors.New("boom") },
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped.Store(true)
+			return ctx.Err()
+		},
+	}, rep)
+
+	assert.EqualError(t, err, "boom")
+	// the other task is stopped and waited for, its cancellation is not reported
+	assert.True(t, stopped.Load())
+	assert.Equal(t, []string{"boom"}, rep.Errors)
+
+	assert.NoError(t, runTasks([]func(ctx context.Context) error{
+		func(ctx context.Context) error { return nil },
+	}, rep))
+}
+
+func TestGenerateImagesArtifacts_DryRunConcurrency(t *testing.T) {
+	imagesManifest := &config.ImagesManifest{}
+	for _, image := range []string{"registry.suse.com/edge/a:1", "registry.suse.com/edge/b:1", "docker.io/library/nginx:1.27"} {
+		imagesManifest.Images = append(imagesManifest.Images, config.Image{Name: image})
+	}
+	reg := registry.New("", "registry.local:5000", "", false)
+	reg.Rewrites = []registry.Rewrite{{From: "registry.suse.com/edge", To: "mirror"}}
+	rep := report.New("3.1.0", "factory", reg.RegistryURL, true)
+
+	err := generateImagesArtifacts(context.Background(), Options{DryRun: true, Concurrency: 3}, &config.ReleaseManifest{}, imagesManifest, reg, rep)
+	require.NoError(t, err)
+
+	targets := map[string]string{}
+	for _, img := range rep.Images {
+		assert.Equal(t, report.StatusDryRun, img.Status)
+		targets[img.Source] = img.Target
+	}
+	assert.Equal(t, map[string]string{
+		"registry.suse.com/edge/a:1":   "registry.local:5000/mirror/a:1",
+		"registry.suse.com/edge/b:1":   "registry.local:5000/mirror/b:1",
+		"docker.io/library/nginx:1.27": "registry.local:5000/library/nginx:1.27",
+	}, targets)
+}
+
+func filterManifests() (*config.ReleaseManifest, *config.ImagesManifest) {
+	releaseManifest, _, _ := fakeReleaseManifest()
+	helmCharts := releaseManifest.Spec.Components.Workloads.Helm
+	chart := helmCharts[0]
+	helmCharts = helmCharts[:0]
+	for _, name := range []string{"rancher", "neuvector", "metal3"} {
+		chart.ReleaseName, chart.Chart = name, "oci://registry.suse.com/edge/charts/"+name
+		helmCharts = append(helmCharts, chart)
+	}
+	releaseManifest.Spec.Components.Workloads.Helm = helmCharts
+
+	imagesManifest := &config.ImagesManifest{}
+	for _, image := range []string{
+		"registry.suse.com/rancher/rancher:v2.9.1",
+		"registry.suse.com/rancher/neuvector-controller:5.4.0",
+		"registry.suse.com/edge/3.1/ironic:24.1",
+		"nginx:1.27",
+	} {
+		imagesManifest.Images = append(imagesManifest.Images, config.Image{Name: image})
+	}
+	return releaseManifest, imagesManifest
+}
+
+func statuses(rep *report.Report) map[string]string {
+	got := map[string]string{}
+	for _, img := range rep.Images {
+		got[img.Source] = img.Status
+	}
+	for _, chart := range rep.Charts {
+		got[chart.Name] = chart.Status
+	}
+	return got
+}
+
+func TestGenerate_Filters(t *testing.T) {
+	releaseManifest, imagesManifest := filterManifests()
+	imageFilter, err := filter.New(nil, []string{"*neuvector*", "re:^nginx"})
+	require.NoError(t, err)
+	chartFilter, err := filter.New([]string{"rancher", "neuvector"}, nil)
+	require.NoError(t, err)
+
+	opts := Options{DryRun: true, Filters: Filters{Images: imageFilter, Charts: chartFilter}}
+	reg := registry.New("", "registry.local:5000", "", false)
+	rep := report.New("3.1.0", "factory", reg.RegistryURL, true)
+
+	require.NoError(t, generateHelmArtifacts(context.Background(), opts, releaseManifest, reg, rep))
+	require.NoError(t, generateImagesArtifacts(context.Background(), opts, releaseManifest, imagesManifest, reg, rep))
+
+	assert.Equal(t, map[string]string{
+		"rancher":   report.StatusDryRun,
+		"neuvector": report.StatusDryRun,
+		"metal3":    report.StatusFiltered,
+		"registry.suse.com/rancher/rancher:v2.9.1":             report.StatusDryRun,
+		"registry.suse.com/rancher/neuvector-controller:5.4.0": report.StatusFiltered,
+		"registry.suse.com/edge/3.1/ironic:24.1":               report.StatusDryRun,
+		"nginx:1.27":                                           report.StatusFiltered,
+	}, statuses(rep))
+
+	rep.Finish()
+	assert.Equal(t, 2, rep.Totals.ImagesFiltered)
+	assert.Equal(t, 1, rep.Totals.ChartsFiltered)
+}
+
+func TestGenerate_ChartImages(t *testing.T) {
+	orig := chartImages
+	defer func() { chartImages = orig }()
+	var rendered []string
+	chartImages = func(h *helm.Helm) ([]string, error) {
+		rendered = append(rendered, h.Name)
+		switch h.Name {
+		case "rancher":
+			return []string{"registry.suse.com/rancher/rancher:v2.9.2", "docker.io/library/nginx:1.26"}, nil
+		case "metal3":
+			return []string{"registry.suse.com/edge/3.1/ironic:24.1"}, nil
+		}
+		return nil, nil
+	}
+
+	releaseManifest, imagesManifest := filterManifests()
+	chartFilter, err := filter.New([]string{"rancher"}, nil)
+	require.NoError(t, err)
+
+	opts := Options{DryRun: true, Filters: Filters{Charts: chartFilter, ChartImages: true}}
+	reg := registry.New("", "registry.local:5000", "", false)
+	rep := report.New("3.1.0", "factory", reg.RegistryURL, true)
+	require.NoError(t, generateImagesArtifacts(context.Background(), opts, releaseManifest, imagesManifest, reg, rep))
+
+	assert.Equal(t, []string{"rancher"}, rendered)
+	// the tags of the charts and of the manifest may differ, the repositories are compared
+	assert.Equal(t, map[string]string{
+		"registry.suse.com/rancher/rancher:v2.9.1":             report.StatusDryRun,
+		"registry.suse.com/rancher/neuvector-controller:5.4.0": report.StatusFiltered,
+		"registry.suse.com/edge/3.1/ironic:24.1":               report.StatusFiltered,
+		"nginx:1.27":                                           report.StatusDryRun,
+	}, statuses(rep))
+	for _, img := range rep.Images {
+		if img.Status == report.StatusFiltered {
+			assert.Equal(t, "not referenced by the selected charts", img.Reason)
+		}
+	}
+
+	chartImages = func(h *helm.Helm) ([]string, error) { return nil, errors.New("render failed") }
+	err = generateImagesArtifacts(context.Background(), opts, releaseManifest, imagesManifest, reg, report.New("3.1.0", "factory", "", true))
+	assert.EqualError(t, err, "render failed")
+}
+
+func TestGenerateAirGapEnvironment_Components(t *testing.T) {
+	ReadAirgapManifestFunc = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		return fakeReleaseManifest()
+	}
+	var stdout bytes.Buffer
+	reportStdout = &stdout
+	defer func() { reportStdout = os.Stdout }()
+
+	// only the charts: no output directory needed, the report goes to stdout only
+	err := GenerateAirGapEnvironment(Options{
+		DryRun: true, ReleaseVersion: "3.1.0", ReleaseMode: "factory",
+		RegistryURL: "registry.local:5000", ReportStdout: true, Components: []string{ComponentHelm},
+	})
+	require.NoError(t, err)
+
+	var rep report.Report
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &rep))
+	assert.Len(t, rep.Charts, 1)
+	assert.Empty(t, rep.Images)
+	assert.Empty(t, rep.Files)
+}
+
+func TestHasComponent(t *testing.T) {
+	opts := Options{Kubernetes: KubernetesBoth}
+	for _, c := range Components {
+		assert.True(t, opts.HasComponent(c), c)
+	}
+	assert.False(t, Options{}.HasComponent(ComponentK3S))
+	assert.True(t, Options{}.HasComponent(ComponentRKE2))
+
+	opts = Options{Kubernetes: KubernetesBoth, Components: []string{ComponentImages, ComponentK3S}}
+	assert.True(t, opts.HasComponent(ComponentK3S))
+	assert.False(t, opts.HasComponent(ComponentRKE2))
+	assert.False(t, opts.HasComponent(ComponentHelm))
+}
+
+func TestValidateComponents(t *testing.T) {
+	assert.NoError(t, ValidateComponents([]string{ComponentImages, ComponentRKE2}))
+	assert.Error(t, ValidateComponents(nil))
+	assert.ErrorContains(t, ValidateComponents([]string{"images", "charts"}), "charts")
+}
+
+func TestValidateKubernetes(t *testing.T) {
+	assert.NoError(t, ValidateKubernetes(KubernetesBoth))
+	assert.ErrorContains(t, ValidateKubernetes("k8s"), "allowed: rke2, k3s, both")
+}
+
+func TestValidateConfig(t *testing.T) {
+	c := &config.SeactlConfig{}
+	assert.NoError(t, ValidateConfig(c))
+
+	c.Components = []string{"images", "charts"}
+	c.Output.Report.Format = "xml"
+	c.Kubernetes.Distribution = "k8s"
+	c.Kubernetes.RKE2.CNIs = []string{"weave"}
+	c.Kubernetes.RKE2.ReleaseURL = "https://example.com/{{.Foo"
+	err := ValidateConfig(c)
+	for _, field := range []string{
+		"components", "output.report.format", "kubernetes.distribution", "kubernetes.rke2.cnis", "kubernetes.rke2.releaseURL",
+	} {
+		assert.ErrorContains(t, err, field)
+	}
+}
+
+func TestUsesHelm(t *testing.T) {
+	assert.True(t, UsesHelm([]string{ComponentHelm}, false))
+	assert.True(t, UsesHelm([]string{ComponentImages}, true))
+	assert.False(t, UsesHelm([]string{ComponentImages, ComponentRKE2}, false))
+	assert.False(t, UsesHelm([]string{ComponentRKE2}, true))
+}
+
+func TestGenerateAirGapEnvironment_Additions(t *testing.T) {
+	ReadAirgapManifestFunc = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		return fakeReleaseManifest()
+	}
+	var stdout bytes.Buffer
+	reportStdout = &stdout
+	defer func() { reportStdout = os.Stdout }()
+
+	err := GenerateAirGapEnvironment(Options{
+		DryRun: true, ReleaseVersion: "3.1.0", ReleaseMode: "factory",
+		RegistryURL: "registry.local:5000", ReportStdout: true, Components: []string{ComponentImages, ComponentHelm},
+		Additions: &config.Additions{
+			Images: []config.Image{{Name: "registry.example.com/operators/my-operator:1.2.0"}},
+			Helm:   []config.HelmWorkload{{ReleaseName: "my-operator", Chart: "oci://registry.example.com/charts/my-operator", Version: "1.2.0"}},
+		},
+	})
+	require.NoError(t, err)
+
+	var rep report.Report
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &rep))
+	assert.Equal(t, map[string]string{
+		"test-image": report.StatusDryRun,
+		"registry.example.com/operators/my-operator:1.2.0": report.StatusDryRun,
+		"test-chart":  report.StatusDryRun,
+		"my-operator": report.StatusDryRun,
+	}, statuses(&rep))
 }
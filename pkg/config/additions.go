@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Additions lists the images and helm charts mirrored on top of the release manifest ones, in the shape of
+// the images manifest and of the release manifest helm workloads
+type Additions struct {
+	Images []Image        `yaml:"images"`
+	Helm   []HelmWorkload `yaml:"helm"`
+}
+
+// LoadAdditions reads and validates the additions file at path, unknown fields are rejected
+func LoadAdditions(path string) (*Additions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading additions file: %v", err)
+	}
+	var a Additions
+	if err := yaml.UnmarshalStrict(data, &a); err != nil {
+		return nil, fmt.Errorf("parsing additions file %s: %v", path, err)
+	}
+	if err := a.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid additions file %s: %w", path, err)
+	}
+	return &a, nil
+}
+
+// Validate returns all the errors of the additions
+func (a *Additions) Validate() error {
+	var errs []error
+	for i, img := range a.Images {
+		if img.Name == "" {
+			errs = append(errs, fmt.Errorf("images[%d]: name is empty", i))
+		}
+	}
+	for i, chart := range a.Helm {
+		if chart.ReleaseName == "" || chart.Chart == "" || chart.Version == "" {
+			errs = append(errs, fmt.Errorf("helm[%d]: releaseName, chart and version are required", i))
+		}
+		if chart.Chart != "" && !strings.HasPrefix(chart.Chart, "oci://") && chart.Repository == "" {
+			errs = append(errs, fmt.Errorf("helm[%d]: repository is required for the non OCI chart %q", i, chart.Chart))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Merge appends the additions to the manifests of the release and returns the number of images and charts
+// added, the images and the chart release names already listed are not added twice
+func (a *Additions) Merge(release *ReleaseManifest, images *ImagesManifest) (int, int) {
+	knownImages := map[string]bool{}
+	for _, img := range images.Images {
+		knownImages[img.Name] = true
+	}
+	addedImages := 0
+	for _, img := range a.Images {
+		if knownImages[img.Name] {
+			slog.Debug("additional image already in the release", "image", img.Name)
+			continue
+		}
+		knownImages[img.Name] = true
+		images.Images = append(images.Images, img)
+		addedImages++
+	}
+
+	workloads := &release.Spec.Components.Workloads
+	knownCharts := map[string]bool{}
+	for _, chart := range workloads.Helm {
+		knownCharts[chart.ReleaseName] = true
+	}
+	addedCharts := 0
+	for _, chart := range a.Helm {
+		if knownCharts[chart.ReleaseName] {
+			slog.Warn("additional helm chart already in the release, skipped", "chart", chart.ReleaseName, "version", chart.Version)
+			continue
+		}
+		knownCharts[chart.ReleaseName] = true
+		workloads.Helm = append(workloads.Helm, chart)
+		addedCharts++
+	}
+	return addedImages, addedCharts
+}
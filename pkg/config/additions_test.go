@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAdditions(t *testing.T) {
+	a, err := LoadAdditions(writeConfig(t, `
+images:
+  - name: registry.example.com/operators/my-operator:1.2.0
+  - name: docker.io/library/nginx:1.27
+helm:
+  - releaseName: my-operator
+    chart: my-operator
+    version: 1.2.0
+    repository: https://charts.example.com
+  - releaseName: extra
+    chart: oci://registry.example.com/charts/extra
+    version: 0.1.0
+`))
+	require.NoError(t, err)
+	assert.Len(t, a.Images, 2)
+	assert.Equal(t, "https://charts.example.com", a.Helm[0].Repository)
+}
+
+func TestLoadAdditions_Errors(t *testing.T) {
+	_, err := LoadAdditions("/does/not/exist.yaml")
+	assert.Error(t, err)
+
+	_, err = LoadAdditions(writeConfig(t, "charts: []\n"))
+	assert.ErrorContains(t, err, "charts")
+
+	_, err = LoadAdditions(writeConfig(t, `
+images:
+  - name: ""
+helm:
+  - releaseName: my-operator
+    chart: my-operator
+  - releaseName: other
+    chart: other
+    version: 1.0.0
+`))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "images[0]")
+	assert.ErrorContains(t, err, "helm[0]: releaseName, chart and version are required")
+	assert.ErrorContains(t, err, "helm[1]: repository is required")
+}
+
+func TestMerge(t *testing.T) {
+	release := &ReleaseManifest{}
+	release.Spec.Components.Workloads.Helm = []HelmWorkload{{ReleaseName: "rancher", Chart: "rancher", Version: "2.9.1"}}
+	images := &ImagesManifest{Images: []Image{{Name: "registry.suse.com/rancher/rancher:v2.9.1"}}}
+
+	a := &Additions{
+		Images: []Image{{Name: "registry.suse.com/rancher/rancher:v2.9.1"}, {Name: "nginx:1.27"}, {Name: "nginx:1.27"}},
+		Helm: []HelmWorkload{
+			{ReleaseName: "rancher", Chart: "rancher", Version: "2.10.0"},
+			{ReleaseName: "my-operator", Chart: "oci://registry.example.com/charts/my-operator", Version: "1.2.0"},
+		},
+	}
+	addedImages, addedCharts := a.Merge(release, images)
+	assert.Equal(t, 1, addedImages)
+	assert.Equal(t, 1, addedCharts)
+	assert.Equal(t, []Image{{Name: "registry.suse.com/rancher/rancher:v2.9.1"}, {Name: "nginx:1.27"}}, images.Images)
+
+	helm := release.Spec.Components.Workloads.Helm
+	require.Len(t, helm, 2)
+	assert.Equal(t, "2.9.1", helm[0].Version)
+	assert.Equal(t, "my-operator", helm[1].ReleaseName)
+}
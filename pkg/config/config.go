@@ -3,70 +3,92 @@ package config
 import (
 	"archive/tar"
 	"bytes"
-	"errors"
 	"fmt"
 	"gopkg.in/yaml.v2"
-	"log"
+	"log/slog"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+
+	"github.com/alknopfler/seactl/pkg/semver"
+	"github.com/alknopfler/seactl/pkg/transport"
 )
 
 const (
-	// releaseMode factory url
-	factoryReleaseURL    = "registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest:%s"
-	productionReleaseURL = "registry.suse.com/edge/%s/release-manifest:%s"
-	releaseManifestPath  = "/release_manifest.yaml"
-	releaseImagesPath    = "/release_images.yaml"
+	// files of the release manifests, at the root of the release container image and of the release source
+	// directories and URLs
+	releaseManifestPath = "/release_manifest.yaml"
+	releaseImagesPath   = "/release_images.yaml"
 )
 
 var execCommand = exec.Command
 
-// Func ReadAirgapManifest from a release-version and pull it from release container, and return a ReleaseManifest struct or an error if something goes wrong
+// Func ReadAirgapManifest from a release-version and read it from the release source of mode (see
+// LookupReleaseSource), and return a ReleaseManifest struct or an error if something goes wrong
 func ReadAirgapManifest(version, mode string) (*ReleaseManifest, *ImagesManifest, error) {
-
-	// Determine the input based on the mode
-	var input string
-	if mode == "factory" {
-		// Use the factory release URL to replace the param version content in %s inside factoryReleaseURL
-		input = fmt.Sprintf(factoryReleaseURL, version)
-	} else if mode == "production" {
-		// Use the production release URL to replace the param version content in %s inside productionReleaseURL
-		input = fmt.Sprintf(productionReleaseURL, strings.Join(strings.Split(version, ".")[:2], "."), version)
-	} else {
-		return nil, nil, errors.New("invalid release mode, must be either 'factory' or 'production'")
+	v, err := semver.ParseRelease(version)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	// Read files content
-	releaseManifestData, err := extractFileFromContainer(input, releaseManifestPath)
+	source, err := LookupReleaseSource(mode)
 	if err != nil {
-		log.Printf("failed to read file: %v", err)
 		return nil, nil, err
 	}
 
-	releaseImagesData, err := extractFileFromContainer(input, releaseImagesPath)
+	// Read files content
+	releaseManifestData, releaseImagesData, err := source.Read(v)
 	if err != nil {
-		log.Printf("failed to read file: %v", err)
+		slog.Error("failed to read the release manifest", "version", version, "mode", mode, "error", err)
 		return nil, nil, err
 	}
 
 	// Unmarshal YAML into struct
 	var releaseManifest ReleaseManifest
 	if err := yaml.Unmarshal(releaseManifestData, &releaseManifest); err != nil {
-		log.Printf("failed to unmarshal YAML: %v", err)
+		slog.Error("failed to unmarshal the release manifest", "version", version, "mode", mode, "error", err)
 		return nil, nil, err
 	}
 	var releaseImages ImagesManifest
 	if err := yaml.Unmarshal(releaseImagesData, &releaseImages); err != nil {
-		log.Printf("failed to unmarshal YAML: %v", err)
+		slog.Error("failed to unmarshal the release images", "version", version, "mode", mode, "error", err)
 		return nil, nil, err
 	}
 
 	return &releaseManifest, &releaseImages, nil
 }
 
+// ReleaseManifestLocation returns where the manifests of version in mode are read from, e.g. the release
+// container image, the production images being under the edge/<major.minor> stream of the version
+func ReleaseManifestLocation(version, mode string) (string, error) {
+	v, err := semver.ParseRelease(version)
+	if err != nil {
+		return "", err
+	}
+	source, err := LookupReleaseSource(mode)
+	if err != nil {
+		return "", err
+	}
+	return source.Location(v)
+}
+
 var extractFileFromContainer = func(imageURL, filePath string) ([]byte, error) {
-	// Pull image
-	if err := execCommand("podman", "pull", imageURL).Run(); err != nil {
+	// Pull image, through the proxy, trusting the source CA bundle and with the source credentials if configured
+	args := []string{"pull", imageURL}
+	if caCert := transport.Current().SourceCACert; caCert != "" {
+		certDir, err := podmanCertDir(caCert)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(certDir)
+		args = append(args, "--cert-dir", certDir)
+	}
+	if authFile := transport.Current().SourceAuthFile; authFile != "" {
+		args = append(args, "--authfile", authFile)
+	}
+	pull := execCommand("podman", args...)
+	pull.Env = transport.Environ(pull.Env)
+	if err := pull.Run(); err != nil {
 		return nil, fmt.Errorf("failed to pull image: %s %w", imageURL, err)
 	}
 
@@ -105,3 +127,20 @@ var extractFileFromContainer = func(imageURL, filePath string) ([]byte, error) {
 		}
 	}
 }
+
+// podmanCertDir returns a temporary --cert-dir for podman holding the CA bundle, podman only reads *.crt files
+func podmanCertDir(caCert string) (string, error) {
+	pem, err := os.ReadFile(caCert)
+	if err != nil {
+		return "", fmt.Errorf("reading source CA certificate: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "seactl-certs-*")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), pem, 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
@@ -143,3 +143,42 @@ func TestReadAirgapManifest_InvalidYAMLImages(t *testing.T) {
 	_, _, err := ReadAirgapManifest("1.0.0", "factory")
 	assert.Error(t, err)
 }
+
+func TestPodmanCertDir(t *testing.T) {
+	caFile := t.TempDir() + "/ca.pem"
+	assert.NoError(t, os.WriteFile(caFile, []byte("pem content"), 0644))
+
+	dir, err := podmanCertDir(caFile)
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data, err := os.ReadFile(dir + "/ca.crt")
+	assert.NoError(t, err)
+	assert.Equal(t, "pem content", string(data))
+
+	_, err = podmanCertDir("/does/not/exist.pem")
+	assert.Error(t, err)
+}
+
+func TestReleaseManifestLocation(t *testing.T) {
+	tests := []struct {
+		version, mode, want string
+	}{
+		{"3.1.0", "factory", "registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest:3.1.0"},
+		{"3.2.0-rc1", "factory", "registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest:3.2.0-rc1"},
+		{"3.1.2", "production", "registry.suse.com/edge/3.1/release-manifest:3.1.2"},
+		{"3.10.0", "production", "registry.suse.com/edge/3.10/release-manifest:3.10.0"},
+		{"10.1.0", "production", "registry.suse.com/edge/10.1/release-manifest:10.1.0"},
+		{"3.1.2", "dir:///srv/manifests", "/srv/manifests/3.1.2"},
+	}
+	for _, tt := range tests {
+		got, err := ReleaseManifestLocation(tt.version, tt.mode)
+		assert.NoError(t, err, tt.version)
+		assert.Equal(t, tt.want, got, tt.version)
+	}
+
+	_, err := ReleaseManifestLocation("3.1.x", "production")
+	assert.Error(t, err)
+	_, err = ReleaseManifestLocation("3.1.0", "staging")
+	assert.Error(t, err)
+}
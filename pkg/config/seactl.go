@@ -0,0 +1,350 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alknopfler/seactl/pkg/filter"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// Version and kind of the seactl config files
+const (
+	SeactlAPIVersion = "seactl.suse.com/v1alpha1"
+	SeactlKind       = "SeactlConfig"
+)
+
+// SeactlConfig is the declarative form of a generate run. Every field maps to a generate flag (see Flags),
+// the flags and the SEACTL_* environment variables override the file.
+type SeactlConfig struct {
+	APIVersion  string           `yaml:"apiVersion"`
+	Kind        string           `yaml:"kind"`
+	Release     SeactlRelease    `yaml:"release"`
+	Components  []string         `yaml:"components"`
+	Additions   string           `yaml:"additions"` // file of extra images and charts, see Additions
+	Source      SeactlSource     `yaml:"source"`
+	Target      SeactlTarget     `yaml:"target"`
+	Output      SeactlOutput     `yaml:"output"`
+	Kubernetes  SeactlKubernetes `yaml:"kubernetes"`
+	Filters     SeactlFilters    `yaml:"filters"`
+	Concurrency int              `yaml:"concurrency"`
+}
+
+// SeactlRelease selects the release manifest
+type SeactlRelease struct {
+	Version string            `yaml:"version"`
+	Mode    string            `yaml:"mode"`
+	Sources map[string]string `yaml:"sources"` // custom release modes, by name, see ParseReleaseSource
+}
+
+// SeactlSource are the settings of the source side: release manifest, images, charts and RKE2/K3s downloads
+type SeactlSource struct {
+	Proxy    string `yaml:"proxy"`
+	CACert   string `yaml:"caCert"`
+	AuthFile string `yaml:"authFile"` // docker/podman auth.json
+}
+
+// SeactlTarget is the registry the artifacts are pushed to
+type SeactlTarget struct {
+	Registry SeactlRegistry     `yaml:"registry"`
+	Rewrites []registry.Rewrite `yaml:"rewrites"`
+}
+
+// SeactlRegistry are the connection settings of the target registry
+type SeactlRegistry struct {
+	URL      string `yaml:"url"`
+	AuthFile string `yaml:"authFile"`
+	CACert   string `yaml:"caCert"`
+	Insecure bool   `yaml:"insecure"`
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+}
+
+// SeactlOutput are the local sinks of the run
+type SeactlOutput struct {
+	Dir                string       `yaml:"dir"`
+	OCILayout          string       `yaml:"ociLayout"`
+	ImagesArchive      string       `yaml:"imagesArchive"`
+	ImagesArchiveSplit int          `yaml:"imagesArchiveSplit"`
+	Report             SeactlReport `yaml:"report"`
+}
+
+// SeactlReport are the run report settings
+type SeactlReport struct {
+	Format string `yaml:"format"`
+	Stdout bool   `yaml:"stdout"`
+}
+
+// SeactlKubernetes selects the Kubernetes distribution artifacts
+type SeactlKubernetes struct {
+	Distribution string     `yaml:"distribution"`
+	RKE2         SeactlRKE2 `yaml:"rke2"`
+}
+
+// SeactlRKE2 are the RKE2 options
+type SeactlRKE2 struct {
+	CNIs         []string `yaml:"cnis"`
+	ReleaseURL   string   `yaml:"releaseURL"`
+	InstallURL   string   `yaml:"installURL"`
+	Upload       bool     `yaml:"upload"`
+	ImagesUpload bool     `yaml:"imagesUpload"`
+}
+
+// SeactlFilters select the images and helm charts of the run
+type SeactlFilters struct {
+	Images      SeactlFilter `yaml:"images"` // on the image references
+	Charts      SeactlFilter `yaml:"charts"` // on the helm release names
+	ChartImages bool         `yaml:"chartImages"`
+}
+
+// SeactlFilter are include and exclude patterns: globs, or regular expressions prefixed with re:
+type SeactlFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// SeactlConfigTemplate is the file written by seactl config init
+const SeactlConfigTemplate = `# seactl generate configuration, the flags and the SEACTL_* environment variables override it
+apiVersion: ` + SeactlAPIVersion + `
+kind: ` + SeactlKind + `
+
+release:
+  # SUSE Edge release version (X.Y.Z, with an optional pre-release tag for the factory builds)
+  version: 3.1.0
+  # factory, production, a name of sources or a release source spec
+  mode: factory
+  # Custom release modes, by name: oci://IMAGE, dir://PATH or http(s)://URL, templated with {{.Version}}
+  # and {{.Stream}} (MAJOR.MINOR) or else followed by the version, e.g.
+  #   staging: oci://registry.example.com/edge/{{.Stream}}/release-manifest:{{.Version}}
+  #   local: dir:///srv/edge-manifests
+  sources: {}
+
+# images, helm, rke2 and/or k3s; images, helm and the kubernetes distribution when empty
+components: []
+
+# File listing extra images and helm charts mirrored on top of the release manifest ones
+additions: ""
+
+# Source side: release manifest, images, charts and RKE2/K3s downloads
+source:
+  proxy: ""
+  caCert: ""
+  # docker/podman auth.json with the credentials of the source registries
+  authFile: ""
+
+target:
+  registry:
+    url: ""
+    authFile: ""
+    caCert: ""
+    insecure: false
+    # client certificate and key for registries requiring mutual TLS
+    cert: ""
+    key: ""
+  # Repository rewrites in the target registry, the first matching rule applies
+  rewrites: []
+  #  - from: registry.suse.com/edge
+  #    to: mirror/edge
+
+output:
+  dir: ./airgap
+  ociLayout: ""
+  # tar or tar.zst, empty to skip the docker-archives
+  imagesArchive: ""
+  imagesArchiveSplit: 0
+  report:
+    # json or yaml
+    format: json
+    stdout: false
+
+kubernetes:
+  # rke2, k3s or both, ignored when components is set
+  distribution: rke2
+  rke2:
+    # calico, canal, cilium, flannel, multus; all of them when empty
+    cnis: []
+    releaseURL: ""
+    installURL: ""
+    upload: false
+    imagesUpload: false
+
+# Images and charts selection: globs (* matching any characters) or regular expressions prefixed with re:
+filters:
+  images:
+    include: []
+    exclude: []
+    #  - "*neuvector*"
+  charts:
+    # helm release names
+    include: []
+    exclude: []
+  # only mirror the images referenced by the selected charts
+  chartImages: false
+
+# Images mirrored in parallel
+concurrency: 1
+`
+
+// LoadSeactlConfig reads and validates the config file at path, unknown fields are rejected
+func LoadSeactlConfig(path string) (*SeactlConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %v", err)
+	}
+	var cfg SeactlConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate returns all the errors of the config, the unset fields are not checked. The components, the
+// distribution, the report format and the RKE2 settings are checked by airgap.ValidateConfig.
+func (c *SeactlConfig) Validate() error {
+	var errs []error
+	check := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", field, err))
+		}
+	}
+
+	if c.APIVersion != SeactlAPIVersion {
+		errs = append(errs, fmt.Errorf("apiVersion: %q, expected %q", c.APIVersion, SeactlAPIVersion))
+	}
+	if c.Kind != SeactlKind {
+		errs = append(errs, fmt.Errorf("kind: %q, expected %q", c.Kind, SeactlKind))
+	}
+
+	if v := c.Release.Version; v != "" {
+		_, err := semver.ParseRelease(v)
+		check("release.version", err)
+	}
+	for _, name := range c.sourceNames() {
+		check("release.sources."+name, ValidateReleaseSource(name, c.Release.Sources[name]))
+	}
+	if m := c.Release.Mode; m != "" {
+		_, preset := releasePresets[m]
+		_, custom := c.Release.Sources[m]
+		if !preset && !custom {
+			if _, err := ParseReleaseSource(m); err != nil {
+				errs = append(errs, fmt.Errorf("release.mode: %q, allowed: 'factory', 'production', a release.sources name or a release source spec", m))
+			}
+		}
+	}
+
+	reg := c.Target.Registry
+	if (reg.Cert == "") != (reg.Key == "") {
+		errs = append(errs, errors.New("target.registry: cert and key must be provided together"))
+	}
+	for i, rw := range c.Target.Rewrites {
+		check(fmt.Sprintf("target.rewrites[%d]", i), rw.Validate())
+	}
+
+	if a := c.Output.ImagesArchive; a != "" && a != "tar" && a != "tar.zst" {
+		errs = append(errs, fmt.Errorf("output.imagesArchive: %q, allowed: 'tar' or 'tar.zst'", a))
+	}
+	if c.Output.ImagesArchiveSplit < 0 {
+		errs = append(errs, fmt.Errorf("output.imagesArchiveSplit: %d, must not be negative", c.Output.ImagesArchiveSplit))
+	}
+	_, err := filter.New(c.Filters.Images.Include, c.Filters.Images.Exclude)
+	check("filters.images", err)
+	_, err = filter.New(c.Filters.Charts.Include, c.Filters.Charts.Exclude)
+	check("filters.charts", err)
+
+	if c.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("concurrency: %d, must not be negative", c.Concurrency))
+	}
+	return errors.Join(errs...)
+}
+
+// Flags returns the values of the set fields by generate flag name, a flag may take several values
+func (c *SeactlConfig) Flags() map[string][]string {
+	flags := map[string][]string{}
+	str := func(flag, value string) {
+		if value != "" {
+			flags[flag] = []string{value}
+		}
+	}
+	boolean := func(flag string, value bool) {
+		if value {
+			flags[flag] = []string{"true"}
+		}
+	}
+	integer := func(flag string, value int) {
+		if value != 0 {
+			flags[flag] = []string{strconv.Itoa(value)}
+		}
+	}
+
+	str("release-version", c.Release.Version)
+	str("release-mode", c.Release.Mode)
+	for _, name := range c.sourceNames() {
+		flags["release-source"] = append(flags["release-source"], name+"="+c.Release.Sources[name])
+	}
+	str("components", strings.Join(c.Components, ","))
+	str("additions", c.Additions)
+
+	str("proxy", c.Source.Proxy)
+	str("source-cacert", c.Source.CACert)
+	str("source-authfile", c.Source.AuthFile)
+
+	str("registry-url", c.Target.Registry.URL)
+	str("registry-authfile", c.Target.Registry.AuthFile)
+	str("registry-cacert", c.Target.Registry.CACert)
+	boolean("insecure", c.Target.Registry.Insecure)
+	str("registry-cert", c.Target.Registry.Cert)
+	str("registry-key", c.Target.Registry.Key)
+	for _, rw := range c.Target.Rewrites {
+		flags["rewrite"] = append(flags["rewrite"], rw.String())
+	}
+
+	str("output", c.Output.Dir)
+	str("oci-layout", c.Output.OCILayout)
+	str("images-archive", c.Output.ImagesArchive)
+	integer("images-archive-split", c.Output.ImagesArchiveSplit)
+	str("report-format", c.Output.Report.Format)
+	boolean("report-stdout", c.Output.Report.Stdout)
+
+	// the components select the distribution themselves
+	if len(c.Components) == 0 {
+		str("kubernetes", c.Kubernetes.Distribution)
+	}
+	str("rke2-cni", strings.Join(c.Kubernetes.RKE2.CNIs, ","))
+	str("rke2-release-url", c.Kubernetes.RKE2.ReleaseURL)
+	str("rke2-install-url", c.Kubernetes.RKE2.InstallURL)
+	boolean("rke2-upload", c.Kubernetes.RKE2.Upload)
+	boolean("rke2-images-upload", c.Kubernetes.RKE2.ImagesUpload)
+
+	list := func(flag string, values []string) {
+		if len(values) > 0 {
+			flags[flag] = values
+		}
+	}
+	list("include-images", c.Filters.Images.Include)
+	list("exclude-images", c.Filters.Images.Exclude)
+	list("include-charts", c.Filters.Charts.Include)
+	list("exclude-charts", c.Filters.Charts.Exclude)
+	boolean("chart-images", c.Filters.ChartImages)
+
+	integer("concurrency", c.Concurrency)
+	return flags
+}
+
+// sourceNames returns the names of the custom release sources, sorted
+func (c *SeactlConfig) sourceNames() []string {
+	var names []string
+	for name := range c.Release.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "seactl.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadSeactlConfig_Template(t *testing.T) {
+	cfg, err := LoadSeactlConfig(writeConfig(t, SeactlConfigTemplate))
+	require.NoError(t, err)
+
+	assert.Equal(t, "3.1.0", cfg.Release.Version)
+	assert.Equal(t, map[string][]string{
+		"release-version": {"3.1.0"},
+		"release-mode":    {"factory"},
+		"output":          {"./airgap"},
+		"report-format":   {"json"},
+		"kubernetes":      {"rke2"},
+		"concurrency":     {"1"},
+	}, cfg.Flags())
+}
+
+func TestLoadSeactlConfig(t *testing.T) {
+	cfg, err := LoadSeactlConfig(writeConfig(t, `
+apiVersion: seactl.suse.com/v1alpha1
+kind: SeactlConfig
+release:
+  version: 3.2.0
+  mode: production
+components: [images, rke2, k3s]
+additions: /etc/seactl/additions.yaml
+source:
+  authFile: /etc/seactl/source-auth.json
+target:
+  registry:
+    url: registry.local:5000
+    insecure: true
+  rewrites:
+    - from: registry.suse.com/edge
+      to: mirror/edge
+    - from: docker.io
+      to: hub
+output:
+  dir: /data/airgap
+  imagesArchive: tar.zst
+  imagesArchiveSplit: 50
+kubernetes:
+  distribution: both
+  rke2:
+    cnis: [canal, multus]
+    imagesUpload: true
+filters:
+  images:
+    exclude: ["*neuvector*", "re:^docker\\.io/"]
+  charts:
+    include: [rancher, metal3]
+  chartImages: true
+concurrency: 4
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []registry.Rewrite{{From: "registry.suse.com/edge", To: "mirror/edge"}, {From: "docker.io", To: "hub"}}, cfg.Target.Rewrites)
+	assert.Equal(t, map[string][]string{
+		"release-version":      {"3.2.0"},
+		"release-mode":         {"production"},
+		"source-authfile":      {"/etc/seactl/source-auth.json"},
+		"registry-url":         {"registry.local:5000"},
+		"insecure":             {"true"},
+		"rewrite":              {"registry.suse.com/edge=mirror/edge", "docker.io=hub"},
+		"output":               {"/data/airgap"},
+		"images-archive":       {"tar.zst"},
+		"images-archive-split": {"50"},
+		"components":           {"images,rke2,k3s"},
+		"additions":            {"/etc/seactl/additions.yaml"},
+		"rke2-cni":             {"canal,multus"},
+		"rke2-images-upload":   {"true"},
+		"exclude-images":       {"*neuvector*", "re:^docker\\.io/"},
+		"include-charts":       {"rancher", "metal3"},
+		"chart-images":         {"true"},
+		"concurrency":          {"4"},
+	}, cfg.Flags())
+}
+
+func TestLoadSeactlConfig_Errors(t *testing.T) {
+	_, err := LoadSeactlConfig("/does/not/exist.yaml")
+	assert.Error(t, err)
+
+	// unknown fields are rejected
+	_, err = LoadSeactlConfig(writeConfig(t, "apiVersion: seactl.suse.com/v1alpha1\nkind: SeactlConfig\nregistry: foo\n"))
+	assert.ErrorContains(t, err, "registry")
+
+	_, err = LoadSeactlConfig(writeConfig(t, `
+apiVersion: v1
+kind: Config
+release:
+  version: "3.1"
+  mode: staging
+target:
+  registry:
+    cert: client.crt
+  rewrites:
+    - to: mirror
+output:
+  imagesArchive: zip
+filters:
+  images:
+    include: ["re:("]
+concurrency: -1
+`))
+	require.Error(t, err)
+	for _, field := range []string{
+		"apiVersion", "kind", "release.version", "release.mode", "target.registry", "target.rewrites[0]",
+		"output.imagesArchive", "filters.images", "concurrency",
+	} {
+		assert.ErrorContains(t, err, field)
+	}
+}
+
+func TestLoadSeactlConfig_ReleaseSources(t *testing.T) {
+	cfg, err := LoadSeactlConfig(writeConfig(t, `
+apiVersion: seactl.suse.com/v1alpha1
+kind: SeactlConfig
+release:
+  version: 3.2.0
+  mode: staging
+  sources:
+    staging: oci://registry.local/edge/{{.Stream}}/release-manifest:{{.Version}}
+    local: dir:///srv/edge-manifests
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"release-version": {"3.2.0"},
+		"release-mode":    {"staging"},
+		"release-source":  {"local=dir:///srv/edge-manifests", "staging=oci://registry.local/edge/{{.Stream}}/release-manifest:{{.Version}}"},
+	}, cfg.Flags())
+
+	_, err = LoadSeactlConfig(writeConfig(t, `
+apiVersion: seactl.suse.com/v1alpha1
+kind: SeactlConfig
+release:
+  mode: qa
+  sources:
+    factory: dir:///srv/edge-manifests
+    Local: dir:///srv/edge-manifests
+`))
+	require.Error(t, err)
+	for _, field := range []string{"release.mode", "release.sources.factory", "release.sources.Local"} {
+		assert.ErrorContains(t, err, field)
+	}
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/alknopfler/seactl/pkg/semver"
+	"github.com/alknopfler/seactl/pkg/transport"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Schemes of the release source specs
+const (
+	SchemeOCI   = "oci://"
+	SchemeDir   = "dir://"
+	SchemeHTTP  = "http://"
+	SchemeHTTPS = "https://"
+)
+
+// releasePresets are the release modes always available
+var releasePresets = map[string]string{
+	"factory":    SchemeOCI + "registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest:{{.Version}}",
+	"production": SchemeOCI + "registry.suse.com/edge/{{.Stream}}/release-manifest:{{.Version}}",
+}
+
+// releaseSources are the custom release modes, by name
+var releaseSources = map[string]string{}
+
+var sourceNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ReleaseSource is where the manifests of the releases of a release mode are read from
+type ReleaseSource interface {
+	// Location returns where the manifests of version are read from, e.g. the release container image
+	Location(v semver.Version) (string, error)
+	// Read returns the release manifest and the images manifest files of version
+	Read(v semver.Version) (releaseManifest, releaseImages []byte, err error)
+}
+
+// SourceData holds the fields available in the release source templates, e.g.
+// oci://registry.example.com/edge/{{.Stream}}/release-manifest:{{.Version}}
+type SourceData struct {
+	Version string // release version, 3.1.2
+	Stream  string // MAJOR.MINOR stream of the version, 3.1
+}
+
+// OCISource reads the manifests from a release container image. Reference is an image reference template,
+// a reference without template actions is tagged with the version.
+type OCISource struct {
+	Reference string
+}
+
+// DirSource reads the manifests from a local directory. Path is a path template, a path without template
+// actions is followed by the version, e.g. /srv/manifests/3.1.2/release_manifest.yaml.
+type DirSource struct {
+	Path string
+}
+
+// HTTPSource downloads the manifests from a web server. URL is a URL template, a URL without template actions
+// is followed by the version, e.g. https://example.com/manifests/3.1.2/release_manifest.yaml.
+type HTTPSource struct {
+	URL string
+}
+
+// ParseReleaseSource returns the release source of spec: oci://IMAGE, dir://PATH or http(s)://URL
+func ParseReleaseSource(spec string) (ReleaseSource, error) {
+	var src ReleaseSource
+	switch {
+	case strings.HasPrefix(spec, SchemeOCI):
+		src = &OCISource{Reference: strings.TrimPrefix(spec, SchemeOCI)}
+	case strings.HasPrefix(spec, SchemeDir):
+		src = &DirSource{Path: strings.TrimPrefix(spec, SchemeDir)}
+	case strings.HasPrefix(spec, SchemeHTTP), strings.HasPrefix(spec, SchemeHTTPS):
+		src = &HTTPSource{URL: spec}
+	default:
+		return nil, fmt.Errorf("invalid release source %q, expected oci://IMAGE, dir://PATH or http(s)://URL", spec)
+	}
+	if _, location, _ := strings.Cut(spec, "://"); location == "" {
+		return nil, fmt.Errorf("invalid release source %q, empty location", spec)
+	}
+	// render a sample version to catch the mistakes before anything is read
+	sample, _ := semver.Parse("0.0.0")
+	if _, err := src.Location(sample); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// ParseReleaseSourceDef splits a NAME=SPEC custom release source definition
+func ParseReleaseSourceDef(def string) (string, string, error) {
+	name, spec, ok := strings.Cut(def, "=")
+	if !ok || name == "" || spec == "" {
+		return "", "", fmt.Errorf("invalid release source %q, expected NAME=SPEC", def)
+	}
+	if err := ValidateReleaseSource(name, spec); err != nil {
+		return "", "", err
+	}
+	return name, spec, nil
+}
+
+// ValidateReleaseSource returns an error if name cannot be used as a release mode or spec is not a valid source
+func ValidateReleaseSource(name, spec string) error {
+	if !sourceNameRe.MatchString(name) {
+		return fmt.Errorf("invalid release source name %q, only lowercase letters, digits, - and _ are allowed", name)
+	}
+	if _, ok := releasePresets[name]; ok {
+		return fmt.Errorf("release source name %q is a preset and cannot be redefined", name)
+	}
+	_, err := ParseReleaseSource(spec)
+	return err
+}
+
+// SetReleaseSources replaces the custom release modes with the NAME=SPEC definitions
+func SetReleaseSources(defs []string) error {
+	sources := map[string]string{}
+	for _, def := range defs {
+		name, spec, err := ParseReleaseSourceDef(def)
+		if err != nil {
+			return err
+		}
+		sources[name] = spec
+	}
+	releaseSources = sources
+	return nil
+}
+
+// ReleaseModes returns the presets followed by the custom release modes
+func ReleaseModes() []string {
+	modes := []string{"factory", "production"}
+	var custom []string
+	for name := range releaseSources {
+		custom = append(custom, name)
+	}
+	sort.Strings(custom)
+	return append(modes, custom...)
+}
+
+// LookupReleaseSource returns the release source of mode: a preset, a custom release source name or a spec
+func LookupReleaseSource(mode string) (ReleaseSource, error) {
+	spec, ok := releasePresets[mode]
+	if !ok {
+		spec, ok = releaseSources[mode]
+	}
+	if !ok {
+		if !strings.Contains(mode, "://") {
+			return nil, fmt.Errorf("invalid release mode %q, allowed: %s or a release source spec", mode, strings.Join(ReleaseModes(), ", "))
+		}
+		spec = mode
+	}
+	return ParseReleaseSource(spec)
+}
+
+// ValidateReleaseMode returns an error if mode is not a preset, a custom release source name or a valid spec
+func ValidateReleaseMode(mode string) error {
+	_, err := LookupReleaseSource(mode)
+	return err
+}
+
+// Image returns the release container image of version
+func (s *OCISource) Image(v semver.Version) (string, error) {
+	image := s.Reference + ":" + v.String()
+	if isTemplate(s.Reference) {
+		var err error
+		if image, err = renderSource(s.Reference, sourceData(v)); err != nil {
+			return "", err
+		}
+	}
+	if _, err := name.ParseReference(image); err != nil {
+		return "", fmt.Errorf("invalid release source image %q: %v", image, err)
+	}
+	return image, nil
+}
+
+// Streamed reports whether the repository depends on the MAJOR.MINOR stream of the version
+func (s *OCISource) Streamed() bool {
+	return strings.Contains(s.Reference, ".Stream")
+}
+
+// Repository returns the repository holding the release images of stream (ignored unless Streamed), the
+// version must be the tag of the images for their repository to be known
+func (s *OCISource) Repository(stream string) (string, error) {
+	if s.Streamed() && stream == "" {
+		return "", fmt.Errorf("the release source %s needs a MAJOR.MINOR stream", s.Reference)
+	}
+	const sample = "0.0.0"
+	image := s.Reference + ":" + sample
+	if isTemplate(s.Reference) {
+		var err error
+		if image, err = renderSource(s.Reference, SourceData{Version: sample, Stream: stream}); err != nil {
+			return "", err
+		}
+	}
+	ref, err := name.NewTag(image)
+	if err != nil || ref.TagStr() != sample {
+		return "", fmt.Errorf("the release source %s does not tag the release images with the version", s.Reference)
+	}
+	return ref.Context().Name(), nil
+}
+
+func (s *OCISource) Location(v semver.Version) (string, error) {
+	return s.Image(v)
+}
+
+func (s *OCISource) Read(v semver.Version) ([]byte, []byte, error) {
+	image, err := s.Image(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	releaseManifest, err := extractFileFromContainer(image, releaseManifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	releaseImages, err := extractFileFromContainer(image, releaseImagesPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return releaseManifest, releaseImages, nil
+}
+
+func (s *DirSource) Location(v semver.Version) (string, error) {
+	return versionBase(s.Path, v)
+}
+
+func (s *DirSource) Read(v semver.Version) ([]byte, []byte, error) {
+	dir, err := s.Location(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	releaseManifest, err := os.ReadFile(filepath.Join(dir, releaseManifestPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	releaseImages, err := os.ReadFile(filepath.Join(dir, releaseImagesPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	return releaseManifest, releaseImages, nil
+}
+
+func (s *HTTPSource) Location(v semver.Version) (string, error) {
+	return versionBase(s.URL, v)
+}
+
+func (s *HTTPSource) Read(v semver.Version) ([]byte, []byte, error) {
+	base, err := s.Location(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	base = strings.TrimSuffix(base, "/")
+	releaseManifest, err := download(base + releaseManifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	releaseImages, err := download(base + releaseImagesPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return releaseManifest, releaseImages, nil
+}
+
+// download returns the body of url, fetched through the source transport
+func download(url string) ([]byte, error) {
+	client := &http.Client{Transport: transport.Source()}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// versionBase renders the location template tmpl, a location without template actions is joined with the version
+func versionBase(tmpl string, v semver.Version) (string, error) {
+	if !isTemplate(tmpl) {
+		return strings.TrimSuffix(tmpl, "/") + "/" + v.String(), nil
+	}
+	return renderSource(tmpl, sourceData(v))
+}
+
+func sourceData(v semver.Version) SourceData {
+	return SourceData{Version: v.String(), Stream: v.MajorMinor()}
+}
+
+// renderSource renders the release source template tmpl with data
+func renderSource(tmpl string, data SourceData) (string, error) {
+	t, err := template.New("source").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid release source template %q: %v", tmpl, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid release source template %q: %v", tmpl, err)
+	}
+	return b.String(), nil
+}
+
+func isTemplate(location string) bool {
+	return strings.Contains(location, "{{")
+}
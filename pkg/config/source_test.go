@@ -0,0 +1,141 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setTestReleaseSources(t *testing.T, defs ...string) {
+	t.Helper()
+	require.NoError(t, SetReleaseSources(defs))
+	t.Cleanup(func() { releaseSources = map[string]string{} })
+}
+
+func mustVersion(t *testing.T, version string) semver.Version {
+	t.Helper()
+	v, err := semver.Parse(version)
+	require.NoError(t, err)
+	return v
+}
+
+func TestParseReleaseSource(t *testing.T) {
+	v := mustVersion(t, "3.1.2")
+	tests := []struct {
+		spec, want string
+	}{
+		{"oci://registry.local/edge/release-manifest", "registry.local/edge/release-manifest:3.1.2"},
+		{"oci://registry.local/edge/{{.Stream}}/release-manifest:{{.Version}}", "registry.local/edge/3.1/release-manifest:3.1.2"},
+		{"dir:///srv/manifests/", "/srv/manifests/3.1.2"},
+		{"dir://manifests/edge-{{.Version}}", "manifests/edge-3.1.2"},
+		{"https://example.com/manifests", "https://example.com/manifests/3.1.2"},
+		{"http://example.com/{{.Stream}}/{{.Version}}/", "http://example.com/3.1/3.1.2/"},
+	}
+	for _, tt := range tests {
+		src, err := ParseReleaseSource(tt.spec)
+		require.NoError(t, err, tt.spec)
+		got, err := src.Location(v)
+		assert.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, got, tt.spec)
+	}
+
+	for _, spec := range []string{
+		"registry.local/edge/release-manifest",
+		"ftp://example.com/manifests",
+		"oci://",
+		"dir://{{.Foo}}",
+		"oci://registry.local/Edge:{{.Version}}",
+		"https://example.com/{{.Version",
+	} {
+		_, err := ParseReleaseSource(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSetReleaseSources(t *testing.T) {
+	setTestReleaseSources(t, "staging=oci://registry.local/staging/release-manifest", "local=dir:///srv/manifests")
+	assert.Equal(t, []string{"factory", "production", "local", "staging"}, ReleaseModes())
+
+	src, err := LookupReleaseSource("staging")
+	require.NoError(t, err)
+	assert.Equal(t, &OCISource{Reference: "registry.local/staging/release-manifest"}, src)
+
+	src, err = LookupReleaseSource("https://example.com/manifests")
+	require.NoError(t, err)
+	assert.Equal(t, &HTTPSource{URL: "https://example.com/manifests"}, src)
+
+	err = ValidateReleaseMode("qa")
+	assert.ErrorContains(t, err, "invalid release mode")
+	assert.ErrorContains(t, err, "factory, production, local, staging")
+
+	for _, def := range []string{"staging", "=dir:///srv", "Staging=dir:///srv", "factory=dir:///srv", "qa=ftp://example.com"} {
+		assert.Error(t, SetReleaseSources([]string{def}), def)
+	}
+}
+
+func TestOCISourceRepository(t *testing.T) {
+	factory := &OCISource{Reference: "registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest:{{.Version}}"}
+	assert.False(t, factory.Streamed())
+	repo, err := factory.Repository("")
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest", repo)
+
+	production := &OCISource{Reference: "registry.suse.com/edge/{{.Stream}}/release-manifest:{{.Version}}"}
+	assert.True(t, production.Streamed())
+	repo, err = production.Repository("3.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.suse.com/edge/3.1/release-manifest", repo)
+	_, err = production.Repository("")
+	assert.Error(t, err)
+
+	repo, err = (&OCISource{Reference: "registry.local/release-manifest"}).Repository("")
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.local/release-manifest", repo)
+
+	_, err = (&OCISource{Reference: "registry.local/release-manifest-{{.Version}}:latest"}).Repository("")
+	assert.ErrorContains(t, err, "does not tag the release images with the version")
+}
+
+func TestDirSourceRead(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "3.1.2")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "release_manifest.yaml"), []byte("kind: ReleaseManifest"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "release_images.yaml"), []byte("images: []"), 0644))
+
+	setTestReleaseSources(t, "local=dir://"+filepath.Dir(dir))
+	rm, im, err := ReadAirgapManifest("3.1.2", "local")
+	require.NoError(t, err)
+	assert.Equal(t, "ReleaseManifest", rm.Kind)
+	assert.Empty(t, im.Images)
+
+	_, _, err = ReadAirgapManifest("3.1.3", "local")
+	assert.Error(t, err)
+}
+
+func TestHTTPSourceRead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/edge/3.1/release_manifest.yaml":
+			w.Write([]byte("kind: ReleaseManifest"))
+		case "/edge/3.1/release_images.yaml":
+			w.Write([]byte("images:\n- name: registry.suse.com/edge/foo:1.0"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	rm, im, err := ReadAirgapManifest("3.1.2", srv.URL+"/edge/{{.Stream}}")
+	require.NoError(t, err)
+	assert.Equal(t, "ReleaseManifest", rm.Kind)
+	assert.Equal(t, []Image{{Name: "registry.suse.com/edge/foo:1.0"}}, im.Images)
+
+	_, _, err = ReadAirgapManifest("3.1.2", srv.URL+"/missing")
+	assert.ErrorContains(t, err, "404")
+}
@@ -40,37 +40,43 @@ type ReleaseManifest struct {
 				SupportedArchs []string `yaml:"supportedArchs"`
 			} `yaml:"operatingSystem"`
 			Workloads struct {
-				Helm []struct {
-					PrettyName  string `yaml:"prettyName"`
-					ReleaseName string `yaml:"releaseName"`
-					Chart       string `yaml:"chart"`
-					Version     string `yaml:"version"`
-					Repository  string `yaml:"repository,omitempty"`
-					Values      struct {
-						PostDelete struct {
-							Enabled bool `yaml:"enabled"`
-						} `yaml:"postDelete"`
-					} `yaml:"values,omitempty"`
-					DependencyCharts []struct {
-						ReleaseName string `yaml:"releaseName"`
-						Chart       string `yaml:"chart"`
-						Version     string `yaml:"version"`
-						Repository  string `yaml:"repository"`
-					} `yaml:"dependencyCharts,omitempty"`
-					AddonCharts []struct {
-						ReleaseName string `yaml:"releaseName"`
-						Chart       string `yaml:"chart"`
-						Version     string `yaml:"version"`
-					} `yaml:"addonCharts,omitempty"`
-				} `yaml:"helm"`
+				Helm []HelmWorkload `yaml:"helm"`
 			} `yaml:"workloads"`
 		} `yaml:"components"`
 	} `yaml:"spec"`
 }
 
+// HelmWorkload is a helm chart of the release manifest workloads
+type HelmWorkload struct {
+	PrettyName  string `yaml:"prettyName"`
+	ReleaseName string `yaml:"releaseName"`
+	Chart       string `yaml:"chart"`
+	Version     string `yaml:"version"`
+	Repository  string `yaml:"repository,omitempty"`
+	Values      struct {
+		PostDelete struct {
+			Enabled bool `yaml:"enabled"`
+		} `yaml:"postDelete"`
+	} `yaml:"values,omitempty"`
+	DependencyCharts []struct {
+		ReleaseName string `yaml:"releaseName"`
+		Chart       string `yaml:"chart"`
+		Version     string `yaml:"version"`
+		Repository  string `yaml:"repository"`
+	} `yaml:"dependencyCharts,omitempty"`
+	AddonCharts []struct {
+		ReleaseName string `yaml:"releaseName"`
+		Chart       string `yaml:"chart"`
+		Version     string `yaml:"version"`
+	} `yaml:"addonCharts,omitempty"`
+}
+
 // ImagesManifest is the struct that represents the images manifest from the release container
 type ImagesManifest struct {
-	Images []struct {
-		Name string `yaml:"name"`
-	} `yaml:"images"`
+	Images []Image `yaml:"images"`
+}
+
+// Image is an image of the images manifest
+type Image struct {
+	Name string `yaml:"name"`
 }
@@ -0,0 +1,327 @@
+package download
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alknopfler/seactl/pkg/progress"
+	"github.com/alknopfler/seactl/pkg/transport"
+)
+
+var (
+	maxAttempts    = 5
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+	// idleTimeout aborts an attempt when no bytes are received for that long, the next attempt resumes
+	idleTimeout = 60 * time.Second
+
+	// httpClient uses the source side transport: proxy settings and source CA bundle
+	httpClient = func() *http.Client {
+		return &http.Client{Transport: transport.Source()}
+	}
+)
+
+// permanentError is an HTTP error that retrying will not fix (e.g. 404)
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// File downloads url into filePath+filename. The content is written to a .part file renamed once complete,
+// so a failed download never leaves a truncated file behind, and interrupted transfers are resumed with
+// HTTP Range requests on the next attempt (or the next run), with exponential backoff between attempts.
+// The ETag (or Last-Modified) of the download is kept next to the .part file and sent in If-Range, so a
+// remote file changed in between is downloaded again from scratch instead of being appended to the old one.
+func File(url, filename, filePath string) error {
+	dest := filePath + filename
+	part := dest + ".part"
+
+	task := progress.Default().Task(filename)
+	defer task.Done()
+
+	backoff := initialBackoff
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = fetch(url, part, task); err == nil {
+			os.Remove(validatorPath(part))
+			if err = os.Rename(part, dest); err != nil {
+				slog.Error("failed to save file", "file", dest, "error", err)
+				os.Remove(part)
+				return err
+			}
+			slog.Info("file downloaded", "file", filename, "dir", filePath)
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt == maxAttempts {
+			break
+		}
+		slog.Warn("download failed, retrying", "file", filename, "attempt", attempt, "maxAttempts", maxAttempts, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	slog.Error("download failed", "file", filename, "url", url, "error", err)
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		// nothing worth resuming
+		os.Remove(part)
+		os.Remove(validatorPath(part))
+	}
+	return fmt.Errorf("failed to download the file %s from %s: %w", filename, url, err)
+}
+
+// fetch runs a single download attempt into part, resuming from its current size, and reports the bytes
+// received to task
+func fetch(url, part string, task *progress.Task) error {
+	out, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create file: %w", err)}
+	}
+	defer out.Close()
+
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	validator := ""
+	if offset > 0 {
+		validator = readValidator(part)
+		if validator == "" {
+			// nothing to check the partial file against, start over
+			offset = 0
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &permanentError{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// the server sends the whole file (200) if it does not match the validator anymore
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			// not the range asked for, drop the partial file and start over on the next attempt
+			out.Truncate(0)
+			os.Remove(validatorPath(part))
+			return fmt.Errorf("unexpected Content-Range %q resuming from byte %d", resp.Header.Get("Content-Range"), offset)
+		}
+		slog.Info("resuming download", "url", url, "offset", offset)
+		task.Resume(offset)
+		if resp.ContentLength >= 0 {
+			task.SetTotal(offset + resp.ContentLength)
+		}
+	case resp.StatusCode == http.StatusOK:
+		// Range not supported (or nothing to resume): start from scratch
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := writeValidator(part, resp); err != nil {
+			return err
+		}
+		task.Resume(0)
+		task.SetTotal(resp.ContentLength)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is not a prefix of the remote one anymore, drop it and retry
+		out.Truncate(0)
+		os.Remove(validatorPath(part))
+		return fmt.Errorf("HTTP status %s resuming from byte %d", resp.Status, offset)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("HTTP status %s", resp.Status)
+	default:
+		return &permanentError{fmt.Errorf("HTTP status %s", resp.Status)}
+	}
+
+	// Abort the attempt if the transfer stalls
+	timer := time.AfterFunc(idleTimeout, cancel)
+	defer timer.Stop()
+	body := &idleReader{r: resp.Body, timer: timer}
+
+	if _, err := io.Copy(out, task.Reader(body)); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return out.Close()
+}
+
+// validatorPath returns the file holding the validator of the partial download part
+func validatorPath(part string) string {
+	return part + ".validator"
+}
+
+// readValidator returns the validator stored for the partial download part, empty if none
+func readValidator(part string) string {
+	data, err := os.ReadFile(validatorPath(part))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeValidator stores the validator of a download starting from scratch: its strong ETag, or its
+// Last-Modified date as weak ETags cannot be used in If-Range. Without any the download cannot be resumed.
+func writeValidator(part string, resp *http.Response) error {
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if validator == "" {
+		if err := os.Remove(validatorPath(part)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(validatorPath(part), []byte(validator+"\n"), 0644)
+}
+
+// contentRangeStart returns the first byte of a "bytes START-END/SIZE" Content-Range header
+func contentRangeStart(header string) (int64, bool) {
+	rng, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// idleReader resets timer on every read, so only stalled transfers time out
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (i *idleReader) Read(p []byte) (int, error) {
+	n, err := i.r.Read(p)
+	if n > 0 {
+		i.timer.Reset(idleTimeout)
+	}
+	return n, err
+}
+
+// EscapeVersion escapes the "+" of a version (e.g. v1.30.3+rke2r1) for the release download URLs
+func EscapeVersion(version string) string {
+	return strings.ReplaceAll(version, "+", "%2B")
+}
+
+// EnsureTrailingSlash returns dir ending with a "/", File expects its filePath to end with one
+func EnsureTrailingSlash(dir string) string {
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return dir
+}
+
+// Size returns the size of the file at url from a HEAD request, following redirects
+func Size(url string) (int64, error) {
+	resp, err := httpClient().Head(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HEAD %s: HTTP status %s", url, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("HEAD %s: unknown size", url)
+	}
+	return resp.ContentLength, nil
+}
+
+// VerifyChecksums checks the sha256 of every file in dir against the sha256sum formatted checksumsFile
+// (also in dir), so only the downloaded subset of a release is validated
+func VerifyChecksums(dir, checksumsFile string, files []string) error {
+	checksums, err := ReadChecksums(filepath.Join(dir, checksumsFile))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file == checksumsFile {
+			continue
+		}
+		expected, ok := checksums[file]
+		if !ok {
+			return fmt.Errorf("no checksum found for %s in %s", file, checksumsFile)
+		}
+		filePath := filepath.Join(dir, file)
+		actual, err := FileSHA256(filePath)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", filePath, expected, actual)
+		}
+		slog.Debug("checksum verified", "file", filePath)
+	}
+	return nil
+}
+
+// ReadChecksums parses a sha256sum file into a map of file name to hex digest
+func ReadChecksums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checksums file: %w", err)
+	}
+	defer f.Close()
+
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		checksums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	return checksums, scanner.Err()
+}
+
+// FileSHA256 returns the hex encoded sha256 of the file at path
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
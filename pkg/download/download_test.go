@@ -0,0 +1,368 @@
+package download
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alknopfler/seactl/pkg/progress"
+)
+
+// --- Tests for File ---
+func TestFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Mock HTTP server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/success" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("file content"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		filename string
+		wantErr  bool
+	}{
+		{
+			name:     "Successful download",
+			url:      server.URL + "/success",
+			filename: "file.txt",
+			wantErr:  false,
+		},
+		{
+			name:     "HTTP error",
+			url:      server.URL + "/fail",
+			filename: "file.txt",
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid directory",
+			url:      server.URL + "/success",
+			filename: "file.txt",
+			wantErr:  true, // because invalid path will cause os.Create to fail
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir
+			if tt.name == "Invalid directory" {
+				dir = "/invalid/dir"
+			}
+			err := File(tt.url, tt.filename, dir+"/")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("File() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// --- Tests for checksums ---
+func TestVerifyChecksums(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("k3s binary")
+	if err := os.WriteFile(filepath.Join(dir, "k3s"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums := fmt.Sprintf("%x  k3s\n%x  other-file.tar.zst\n", sha256.Sum256(content), sha256.Sum256([]byte("other")))
+	if err := os.WriteFile(filepath.Join(dir, "sha256sum-amd64.txt"), []byte(sums), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyChecksums(dir, "sha256sum-amd64.txt", []string{"k3s", "sha256sum-amd64.txt"}); err != nil {
+		t.Errorf("VerifyChecksums() error = %v", err)
+	}
+	if err := VerifyChecksums(dir, "sha256sum-amd64.txt", []string{"missing"}); err == nil {
+		t.Errorf("VerifyChecksums() should fail when the file has no checksum")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "k3s"), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChecksums(dir, "sha256sum-amd64.txt", []string{"k3s"}); err == nil {
+		t.Errorf("VerifyChecksums() should fail on checksum mismatch")
+	}
+}
+
+func TestVerifyChecksums_MissingChecksumsFile(t *testing.T) {
+	if err := VerifyChecksums(t.TempDir(), "sha256sum-amd64.txt", []string{"k3s"}); err == nil {
+		t.Errorf("VerifyChecksums() should fail without checksums file")
+	}
+}
+
+// --- Tests for retries and resume ---
+func setFastRetries(t *testing.T) {
+	t.Helper()
+	origBackoff, origIdle := initialBackoff, idleTimeout
+	initialBackoff, idleTimeout = time.Millisecond, 200*time.Millisecond
+	t.Cleanup(func() { initialBackoff, idleTimeout = origBackoff, origIdle })
+}
+
+func TestFile_RetriesServerErrors(t *testing.T) {
+	setFastRetries(t)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("file content"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := File(server.URL+"/file", "file.txt", dir+"/"); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestFile_NoRetryOnNotFound(t *testing.T) {
+	setFastRetries(t)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := File(server.URL+"/file", "file.txt", dir+"/"); err == nil {
+		t.Fatalf("File() should fail on 404")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no leftover files, got %v", entries)
+	}
+}
+
+func TestFile_ResumesPartialDownload(t *testing.T) {
+	setFastRetries(t)
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	// A previous run left the first half behind
+	dir := t.TempDir()
+	writePart(t, dir, content[:500], `"v1"`)
+
+	if err := File(server.URL+"/file.txt", "file.txt", dir+"/"); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("resumed file content mismatch")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "file.txt.part")); !os.IsNotExist(err) {
+		t.Errorf("expected .part file to be renamed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "file.txt.part.validator")); !os.IsNotExist(err) {
+		t.Errorf("expected the validator to be removed")
+	}
+}
+
+// writePart leaves a partial download of content behind, as an interrupted run does
+func writePart(t *testing.T, dir, content, validator string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt.part"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if validator == "" {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt.part.validator"), []byte(validator+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFile_RestartsWhenRemoteChanged(t *testing.T) {
+	setFastRetries(t)
+	content := strings.Repeat("abcdefghij", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	// The partial file was downloaded from the previous version of the remote file
+	dir := t.TempDir()
+	writePart(t, dir, strings.Repeat("0123456789", 50), `"v1"`)
+
+	if err := File(server.URL+"/file.txt", "file.txt", dir+"/"); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if string(got) != content {
+		t.Errorf("expected the changed file to be downloaded again from scratch")
+	}
+}
+
+func TestFile_RestartsWithoutValidator(t *testing.T) {
+	setFastRetries(t)
+	content := strings.Repeat("abcdefghij", 100)
+	var ranges int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranges, 1)
+		}
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writePart(t, dir, strings.Repeat("0123456789", 50), "")
+
+	if err := File(server.URL+"/file.txt", "file.txt", dir+"/"); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if string(got) != content {
+		t.Errorf("expected the file to be downloaded from scratch")
+	}
+	if ranges != 0 {
+		t.Errorf("expected no Range request without validator, got %d", ranges)
+	}
+}
+
+func TestFile_RestartsOnUnexpectedContentRange(t *testing.T) {
+	setFastRetries(t)
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") != "" {
+			// a server answering with another range than the one asked for
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-99/%d", len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[:100]))
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writePart(t, dir, content[:500], `"v1"`)
+
+	if err := File(server.URL+"/file.txt", "file.txt", dir+"/"); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if string(got) != content {
+		t.Errorf("expected the file to be downloaded again from scratch, got %d bytes", len(got))
+	}
+}
+
+func TestFile_StalledTransferIsRetried(t *testing.T) {
+	setFastRetries(t)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("file content"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := File(server.URL+"/file", "file.txt", dir+"/"); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if string(got) != "file content" {
+		t.Errorf("unexpected content %q", got)
+	}
+}
+
+func TestFile_ReportsProgress(t *testing.T) {
+	setFastRetries(t)
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	orig := progress.Default()
+	tracker := progress.New(io.Discard, false, time.Minute)
+	progress.SetDefault(tracker)
+	defer progress.SetDefault(orig)
+
+	// The bytes resumed from a previous run are not counted as transferred
+	dir := t.TempDir()
+	writePart(t, dir, content[:400], `"v1"`)
+
+	if err := File(server.URL+"/file.txt", "file.txt", dir+"/"); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if got := tracker.Stats().Transferred; got != 600 {
+		t.Errorf("transferred = %d, want 600", got)
+	}
+}
+
+// --- Tests for the URL and path helpers ---
+func TestEscapeVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{"With plus", "v1.21.3+rke2r1", "v1.21.3%2Brke2r1"},
+		{"Without plus", "v1.21.3", "v1.21.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EscapeVersion(tt.version); got != tt.want {
+				t.Errorf("EscapeVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureTrailingSlash(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{"No slash", "test", "test/"},
+		{"With slash", "test/", "test/"},
+		{"Relative path with slash", "./test/", "./test/"},
+		{"Nested path with slash", "./aa/test/", "./aa/test/"},
+		{"Nested path no slash", "./aa/test", "./aa/test/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EnsureTrailingSlash(tt.dir); got != tt.want {
+				t.Errorf("EnsureTrailingSlash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
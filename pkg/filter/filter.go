@@ -0,0 +1,104 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RegexPrefix marks a pattern as a regular expression, the other patterns are globs
+const RegexPrefix = "re:"
+
+// Filter selects names, image references or helm release names, with include and exclude patterns. A glob
+// pattern matches the whole name, its * matching any characters ("/" included) and ? a single one. A
+// pattern prefixed with RegexPrefix is a regular expression matching anywhere in the name unless anchored.
+// A nil Filter selects every name.
+type Filter struct {
+	include []pattern
+	exclude []pattern
+}
+
+type pattern struct {
+	text string
+	re   *regexp.Regexp
+}
+
+// New returns a filter selecting the names matching one of the include patterns (every name when there is
+// none) and none of the exclude patterns
+func New(include, exclude []string) (*Filter, error) {
+	f := &Filter{}
+	var err error
+	if f.include, err = compile(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compile(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func compile(patterns []string) ([]pattern, error) {
+	var compiled []pattern
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		expr := globToRegexp(p)
+		if strings.HasPrefix(p, RegexPrefix) {
+			expr = strings.TrimPrefix(p, RegexPrefix)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q: %v", p, err)
+		}
+		compiled = append(compiled, pattern{text: p, re: re})
+	}
+	return compiled, nil
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
+
+// Empty reports whether the filter selects every name
+func (f *Filter) Empty() bool {
+	return f == nil || len(f.include) == 0 && len(f.exclude) == 0
+}
+
+// Match reports whether name is selected, with the reason when it is not
+func (f *Filter) Match(name string) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	if len(f.include) > 0 {
+		included := false
+		for _, p := range f.include {
+			if p.re.MatchString(name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, "not matching any include pattern"
+		}
+	}
+	for _, p := range f.exclude {
+		if p.re.MatchString(name) {
+			return false, fmt.Sprintf("matching exclude pattern %q", p.text)
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,62 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	f, err := New(
+		[]string{"registry.suse.com/edge/*", "re:^docker\\.io/library/(nginx|busybox):"},
+		[]string{"*neuvector*", "*/rancher:v?.*"},
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		want   bool
+		reason string
+	}{
+		{"registry.suse.com/edge/3.1/kubevirt-operator:1.3.1", true, ""},
+		{"docker.io/library/nginx:1.27", true, ""},
+		{"docker.io/library/redis:7", false, "not matching any include pattern"},
+		{"registry.suse.com/edge/3.1/neuvector-controller:5.4", false, `matching exclude pattern "*neuvector*"`},
+		{"registry.suse.com/edge/3.1/rancher:v2.9.1", false, `matching exclude pattern "*/rancher:v?.*"`},
+		{"registry.suse.com/edge/3.1/rancher-webhook:v0.5", true, ""},
+	}
+	for _, tt := range tests {
+		got, reason := f.Match(tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+		assert.Equal(t, tt.reason, reason, tt.name)
+	}
+}
+
+func TestMatch_ExcludeOnly(t *testing.T) {
+	f, err := New(nil, []string{"rancher*"})
+	require.NoError(t, err)
+
+	ok, _ := f.Match("metal3")
+	assert.True(t, ok)
+	ok, _ = f.Match("rancher-turtles")
+	assert.False(t, ok)
+	assert.False(t, f.Empty())
+}
+
+func TestNilFilter(t *testing.T) {
+	var f *Filter
+	ok, reason := f.Match("anything")
+	assert.True(t, ok)
+	assert.Empty(t, reason)
+	assert.True(t, f.Empty())
+
+	f, err := New([]string{""}, nil)
+	require.NoError(t, err)
+	assert.True(t, f.Empty())
+}
+
+func TestNew_InvalidRegexp(t *testing.T) {
+	_, err := New(nil, []string{"re:("})
+	assert.Error(t, err)
+}
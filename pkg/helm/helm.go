@@ -2,13 +2,17 @@ package helm
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/transport"
+	"github.com/google/go-containerregistry/pkg/name"
 )
 
 const (
@@ -38,42 +42,92 @@ func New(name, version, chart, url string, reg *registry.Registry) *Helm {
 }
 
 func (h *Helm) Download() error {
-	var args []string
-
-	// Determine chart reference
-	if strings.HasPrefix(h.Chart, "oci://") {
-		// OCI chart: full reference is already in h.Chart
-		args = []string{"pull", h.Chart, "--version", h.Version, "-d", tempDir}
-	} else {
-		if h.URL == "" {
-			return fmt.Errorf("repository URL is missing for chart %s", h.Name)
-		}
-
-		// Regular Helm repo chart
-		args = []string{
-			"pull", h.Chart,
-			"--repo", strings.TrimSuffix(h.URL, "/"),
-			"--version", h.Version,
-			"-d", tempDir,
-		}
+	args, err := h.sourceArgs("pull")
+	if err != nil {
+		return err
 	}
+	args = append(args, "-d", tempDir)
+
 	// Execute the command
 	cmd := execCommand("helm", args...)
-	cmd.Stdout = os.Stdout
+	cmd.Env = transport.Environ(cmd.Env)
+	// stdout is kept for the run report
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = nil
 
 	if err := cmd.Run(); err != nil {
-		log.Printf("failed to download chart: %v", err)
+		slog.Error("failed to download chart", "chart", h.Name, "version", h.Version, "error", err)
 		return err
 	}
 
 	return nil
 }
 
+// sourceArgs returns the helm arguments of command (pull or template) reading the chart from its source:
+// the chart reference, version and repository, the source CA bundle and credentials
+func (h *Helm) sourceArgs(command ...string) ([]string, error) {
+	args := append(append([]string{}, command...), h.Chart, "--version", h.Version)
+	if !strings.HasPrefix(h.Chart, "oci://") {
+		// Regular Helm repo chart, an OCI reference is already complete
+		if h.URL == "" {
+			return nil, fmt.Errorf("repository URL is missing for chart %s", h.Name)
+		}
+		args = append(args, "--repo", strings.TrimSuffix(h.URL, "/"))
+	}
+	// Trust the source CA bundle for the chart repositories, along with the system roots helm would drop
+	caFile, err := transport.SourceCABundle()
+	if err != nil {
+		return nil, err
+	}
+	if caFile != "" {
+		args = append(args, "--ca-file", caFile)
+	}
+	// Credentials of the OCI chart registries
+	if authFile := transport.Current().SourceAuthFile; authFile != "" {
+		args = append(args, "--registry-config", authFile)
+	}
+	return args, nil
+}
+
+// Images renders the chart with its default values and returns the images its manifests reference, the
+// images of the components disabled by default are not listed
+func (h *Helm) Images() ([]string, error) {
+	args, err := h.sourceArgs("template", h.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := execCommand("helm", args...)
+	cmd.Env = transport.Environ(cmd.Env)
+	out, err := cmd.Output()
+	if err != nil {
+		slog.Error("failed to render chart", "chart", h.Name, "version", h.Version, "error", err)
+		return nil, fmt.Errorf("rendering chart %s: %v", h.Name, err)
+	}
+	return ParseImages(out), nil
+}
+
+// imageLine matches the image fields of the rendered manifests, quoted or not, in a list or not
+var imageLine = regexp.MustCompile(`(?m)^[\s-]*image:\s*["']?([^"'\s]+)["']?\s*$`)
+
+// ParseImages returns the distinct images referenced by the rendered manifests, in order
+func ParseImages(manifests []byte) []string {
+	var images []string
+	seen := map[string]bool{}
+	for _, m := range imageLine.FindAllSubmatch(manifests, -1) {
+		image := string(m[1])
+		if !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
 func (h *Helm) Verify() error {
 	_, err := h.findDownloadedChart()
 	if err != nil {
-		log.Printf("file does not exist to be verified %s", err.Error())
+		slog.Error("chart archive not found", "chart", h.Name, "version", h.Version, "error", err)
 		return err
 	}
 	return nil
@@ -82,29 +136,57 @@ func (h *Helm) Verify() error {
 func (h *Helm) Upload() error {
 	chartPath, err := h.findDownloadedChart()
 	if err != nil {
-		log.Printf("file does not exist to be uploaded %s", err.Error())
+		slog.Error("chart archive not found", "chart", h.Name, "version", h.Version, "error", err)
 		return err
 	}
 
 	var args []string
-	args = append(args, "push", chartPath, "oci://"+h.reg.RegistryURL)
+	args = append(args, "push", chartPath, h.pushDestination())
 
 	if h.Insecure {
 		args = append(args, "--insecure-skip-tls-verify")
 	} else if h.reg.RegistryCACert != "" {
 		args = append(args, "--ca-file", h.reg.RegistryCACert)
 	}
+	if h.reg.RegistryClientCert != "" && h.reg.RegistryClientKey != "" {
+		args = append(args, "--cert-file", h.reg.RegistryClientCert, "--key-file", h.reg.RegistryClientKey)
+	}
 
 	cmd := execCommand("helm", args...)
+	cmd.Env = transport.Environ(cmd.Env)
 	err = cmd.Run()
 	if err != nil {
-		log.Printf("failed to push to the registry: %s", err)
+		slog.Error("failed to push chart", "chart", h.Name, "version", h.Version, "registry", h.reg.RegistryURL, "error", err)
 		return err
 	}
 	defer os.Remove(chartPath)
 	return nil
 }
 
+// TargetReference returns the reference the chart is pushed to, oci://REGISTRY/[PATH/]CHART:VERSION
+func (h *Helm) TargetReference() string {
+	return fmt.Sprintf("%s/%s:%s", h.pushDestination(), path.Base(strings.TrimPrefix(h.Chart, "oci://")), h.Version)
+}
+
+// pushDestination returns the location helm push appends the chart name to: the root of the registry, or
+// the parent path a rewrite rule maps the OCI repository of the chart to. The chart keeps its name.
+func (h *Helm) pushDestination() string {
+	dest := "oci://" + h.reg.RegistryURL
+	if !strings.HasPrefix(h.Chart, "oci://") {
+		return dest
+	}
+	repo, err := name.NewRepository(strings.TrimPrefix(h.Chart, "oci://"))
+	if err != nil {
+		return dest
+	}
+	if target, ok := h.reg.RewriteRepository(repo); ok {
+		if dir := path.Dir(target); dir != "." {
+			dest += "/" + dir
+		}
+	}
+	return dest
+}
+
 func (h *Helm) findDownloadedChart() (string, error) {
 	pattern := fmt.Sprintf("%s*.tgz", h.Name)
 	matches, err := filepath.Glob(filepath.Join(tempDir, pattern))
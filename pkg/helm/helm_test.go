@@ -1,12 +1,17 @@
 package helm
 
 import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/transport"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -125,6 +130,28 @@ func TestUpload_Success_WithCA(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestUpload_Success_WithClientCert(t *testing.T) {
+	reg := registry.New("auth.json", "registry.io", "", false)
+	reg.RegistryClientCert = "client.crt"
+	reg.RegistryClientKey = "client.key"
+	h := New("mychart", "1.0.0", "chart", "", reg)
+	file := filepath.Join(tempDir, "mychart-1.0.0.tgz")
+	err := os.WriteFile(file, []byte("dummy"), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(file)
+
+	var gotArgs []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return fakeExecCommandSuccess(command, args...)
+	}
+	defer func() { execCommand = exec.Command }()
+
+	err = h.Upload()
+	assert.NoError(t, err)
+	assert.Contains(t, strings.Join(gotArgs, " "), "--cert-file client.crt --key-file client.key")
+}
+
 func TestUpload_Fail(t *testing.T) {
 	reg := registry.New("auth.json", "registry.io", "", false)
 	h := New("mychart", "1.0.0", "chart", "", reg)
@@ -139,3 +166,122 @@ func TestUpload_Fail(t *testing.T) {
 	err = h.Upload()
 	assert.Error(t, err)
 }
+
+const renderedChart = `---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+        - image: "registry.suse.com/edge/3.1/init:1.0"
+      containers:
+        - name: controller
+          image: registry.suse.com/rancher/neuvector-controller:5.4.0
+          imagePullPolicy: IfNotPresent
+        - name: sidecar
+          image: 'docker.io/library/busybox:1.36'
+---
+apiVersion: batch/v1
+kind: Job
+spec:
+  template:
+    spec:
+      containers:
+        - image: registry.suse.com/rancher/neuvector-controller:5.4.0
+          env:
+            - name: IMAGE
+              value: "not-an-image-field"
+`
+
+func fakeExecCommandTemplate(command string, args ...string) *exec.Cmd {
+	cs := []string{"-test.run=TestHelperProcessTemplate", "--", command}
+	cs = append(cs, args...)
+	cmd := exec.Command(os.Args[0], cs...)
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS_TEMPLATE=1"}
+	return cmd
+}
+
+func TestHelperProcessTemplate(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS_TEMPLATE") != "1" {
+		return
+	}
+	os.Stdout.WriteString(renderedChart)
+	os.Exit(0)
+}
+
+func TestParseImages(t *testing.T) {
+	assert.Equal(t, []string{
+		"registry.suse.com/edge/3.1/init:1.0",
+		"registry.suse.com/rancher/neuvector-controller:5.4.0",
+		"docker.io/library/busybox:1.36",
+	}, ParseImages([]byte(renderedChart)))
+	assert.Empty(t, ParseImages(nil))
+}
+
+func TestImages(t *testing.T) {
+	h := New("neuvector", "104.0.0", "neuvector", "https://charts.io/", nil)
+	execCommand = fakeExecCommandTemplate
+	defer func() { execCommand = exec.Command }()
+
+	images, err := h.Images()
+	assert.NoError(t, err)
+	assert.Len(t, images, 3)
+
+	args, err := h.sourceArgs("template", h.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"template", "neuvector", "neuvector", "--version", "104.0.0", "--repo", "https://charts.io"}, args)
+}
+
+func TestImages_Error(t *testing.T) {
+	h := New("neuvector", "104.0.0", "oci://registry.io/neuvector", "", nil)
+	execCommand = fakeExecCommandFail
+	defer func() { execCommand = exec.Command }()
+
+	_, err := h.Images()
+	assert.Error(t, err)
+}
+
+func TestSourceArgs_SourceCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, caPEM, 0644))
+
+	assert.NoError(t, transport.Configure(transport.Settings{SourceCACert: caFile}))
+	defer func() {
+		transport.Configure(transport.Settings{})
+		transport.Cleanup()
+	}()
+
+	// --ca-file replaces the system roots of helm, it gets them along with the source CA bundle
+	h := New("neuvector", "104.0.0", "oci://registry.io/neuvector", "", nil)
+	args, err := h.sourceArgs("pull")
+	assert.NoError(t, err)
+	assert.Equal(t, "--ca-file", args[len(args)-2])
+	assert.NotEqual(t, caFile, args[len(args)-1])
+	bundle, err := os.ReadFile(args[len(args)-1])
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(bundle), string(caPEM)))
+}
+
+func TestTargetReference(t *testing.T) {
+	reg := registry.New("", "registry.local:5000", "", false)
+	reg.Rewrites = []registry.Rewrite{{From: "registry.suse.com/edge", To: "mirror/edge"}}
+
+	tests := []struct {
+		chart, url string
+		want       string
+	}{
+		// the OCI charts under a rewrite rule are pushed under the rewritten path
+		{"oci://registry.suse.com/edge/charts/metallb", "", "oci://registry.local:5000/mirror/edge/charts/metallb:1.0.0"},
+		// the other ones at the root of the registry
+		{"oci://registry.example.com/charts/metallb", "", "oci://registry.local:5000/metallb:1.0.0"},
+		{"metallb", "https://charts.io", "oci://registry.local:5000/metallb:1.0.0"},
+	}
+	for _, tt := range tests {
+		h := New("metallb-release", "1.0.0", tt.chart, tt.url, reg)
+		assert.Equal(t, tt.want, h.TargetReference(), tt.chart)
+	}
+}
@@ -0,0 +1,193 @@
+package images
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ArchiveFormatTar writes plain docker-archive tarballs
+	ArchiveFormatTar = "tar"
+	// ArchiveFormatTarZstd writes zstd compressed docker-archive tarballs
+	ArchiveFormatTarZstd = "tar.zst"
+
+	// archivePrefix follows the rke2-images-*.linux-amd64.tar.zst naming of the RKE2 release artifacts, the
+	// archives being copied next to them in the agent images directory, /var/lib/rancher/rke2/agent/images
+	archivePrefix = "rke2-images-edge"
+	archiveSuffix = "linux-amd64"
+)
+
+// ErrNotDockerArchive is returned by LoadArchive when the tarball has no docker-archive manifest.json
+var ErrNotDockerArchive = errors.New("not a docker-archive")
+
+// ArchiveNames returns the file names of the archives needed to store count images, with at most
+// maxImages per archive (0 means all of them in a single archive)
+func ArchiveNames(count, maxImages int, format string) []string {
+	if maxImages <= 0 || count <= maxImages {
+		return []string{fmt.Sprintf("%s.%s.%s", archivePrefix, archiveSuffix, format)}
+	}
+	var names []string
+	for n := 1; (n-1)*maxImages < count; n++ {
+		names = append(names, fmt.Sprintf("%s-%d.%s.%s", archivePrefix, n, archiveSuffix, format))
+	}
+	return names
+}
+
+// WriteArchives packs the pulled images into docker-archive tarballs in outputDir, ready to be copied to
+// /var/lib/rancher/rke2/agent/images/. It returns the paths of the written archives.
+func WriteArchives(imgs []*Images, outputDir, format string, maxImages int) ([]string, error) {
+	if format != ArchiveFormatTar && format != ArchiveFormatTarZstd {
+		return nil, fmt.Errorf("invalid archive format %q, allowed: %q or %q", format, ArchiveFormatTar, ArchiveFormatTarZstd)
+	}
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating output directory: %v", err)
+	}
+
+	var paths []string
+	for n, fileName := range ArchiveNames(len(imgs), maxImages, format) {
+		chunk := imgs
+		if maxImages > 0 && len(imgs) > maxImages {
+			end := (n + 1) * maxImages
+			if end > len(imgs) {
+				end = len(imgs)
+			}
+			chunk = imgs[n*maxImages : end]
+		}
+
+		path := filepath.Join(outputDir, fileName)
+		if err := writeArchive(path, chunk, format == ArchiveFormatTarZstd); err != nil {
+			return paths, err
+		}
+		slog.Info("docker-archive written", "archive", path, "images", len(chunk))
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func writeArchive(path string, imgs []*Images, compress bool) error {
+	refToImage := make(map[name.Reference]v1.Image, len(imgs))
+	for _, img := range imgs {
+		ref, err := name.ParseReference(img.Name)
+		if err != nil {
+			return fmt.Errorf("parsing reference %q: %v", img.Name, err)
+		}
+		if img.ImageRef == nil {
+			return fmt.Errorf("image %q has not been downloaded", img.Name)
+		}
+		refToImage[ref] = img.ImageRef
+	}
+
+	// Write to a temporary file so an interrupted run never leaves a truncated archive behind
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("creating archive %s: %v", path, err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	var w io.WriteCloser = out
+	if compress {
+		if w, err = zstd.NewWriter(out); err != nil {
+			return fmt.Errorf("creating zstd writer: %v", err)
+		}
+	}
+
+	if err := tarball.MultiRefWrite(refToImage, w); err != nil {
+		if compress {
+			// stops the encoder goroutines, the archive is dropped anyway
+			w.Close()
+		}
+		return fmt.Errorf("writing archive %s: %v", path, err)
+	}
+	if compress {
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("compressing archive %s: %v", path, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("closing archive %s: %v", path, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadArchive loads every tagged image of the docker-archive at path (plain or zstd compressed, like the
+// rke2-images-*.tar.zst files), ready to be uploaded. zstd archives are decompressed to a temporary file,
+// removed by the returned cleanup function once the images are not needed anymore.
+func LoadArchive(path string, reg *registry.Registry) ([]*Images, func(), error) {
+	cleanup := func() {}
+	archive := path
+	if strings.HasSuffix(path, ".zst") {
+		tmp, err := decompressZstd(path)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.Remove(tmp) }
+		archive = tmp
+	}
+
+	opener := func() (io.ReadCloser, error) { return os.Open(archive) }
+	descriptors, err := tarball.LoadManifest(opener)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, fmt.Errorf("%s: %w: %v", path, ErrNotDockerArchive, err)
+	}
+
+	var imgs []*Images
+	for _, d := range descriptors {
+		for _, repoTag := range d.RepoTags {
+			tag, err := name.NewTag(repoTag)
+			if err != nil {
+				slog.Warn("skipping invalid image tag", "image", repoTag, "archive", path, "error", err)
+				continue
+			}
+			img, err := tarball.Image(opener, &tag)
+			if err != nil {
+				cleanup()
+				return nil, func() {}, fmt.Errorf("loading image %q from %s: %v", repoTag, path, err)
+			}
+			i := New(repoTag, reg)
+			i.ImageRef = img
+			imgs = append(imgs, i)
+		}
+	}
+	slog.Info("docker-archive loaded", "archive", path, "images", len(imgs))
+	return imgs, cleanup, nil
+}
+
+func decompressZstd(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	zr, err := zstd.NewReader(in)
+	if err != nil {
+		return "", fmt.Errorf("reading zstd archive %s: %v", path, err)
+	}
+	defer zr.Close()
+
+	out, err := os.CreateTemp("", "seactl-*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, zr); err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("decompressing %s: %v", path, err)
+	}
+	return out.Name(), nil
+}
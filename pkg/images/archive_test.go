@@ -0,0 +1,144 @@
+package images
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomImages(t *testing.T, names ...string) []*Images {
+	t.Helper()
+	reg := registry.New("auth.json", "registry.io", "", false)
+	var imgs []*Images
+	for _, n := range names {
+		ri, err := random.Image(256, 1)
+		require.NoError(t, err)
+		img := New(n, reg)
+		img.ImageRef = ri
+		imgs = append(imgs, img)
+	}
+	return imgs
+}
+
+func TestArchiveNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		maxImages int
+		format    string
+		want      []string
+	}{
+		{"Single archive", 10, 0, ArchiveFormatTarZstd, []string{"rke2-images-edge.linux-amd64.tar.zst"}},
+		{"Below split", 3, 5, ArchiveFormatTar, []string{"rke2-images-edge.linux-amd64.tar"}},
+		{"Split", 5, 2, ArchiveFormatTar, []string{
+			"rke2-images-edge-1.linux-amd64.tar",
+			"rke2-images-edge-2.linux-amd64.tar",
+			"rke2-images-edge-3.linux-amd64.tar",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ArchiveNames(tt.count, tt.maxImages, tt.format))
+		})
+	}
+}
+
+func TestWriteArchives_Tar(t *testing.T) {
+	dir := t.TempDir()
+	imgs := randomImages(t, "registry.io/app-a:1", "registry.io/app-b:1", "registry.io/app-c:1")
+
+	paths, err := WriteArchives(imgs, dir, ArchiveFormatTar, 2)
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+
+	m, err := tarball.LoadManifest(func() (io.ReadCloser, error) { return os.Open(paths[0]) })
+	require.NoError(t, err)
+	require.Len(t, m, 2)
+	assert.Equal(t, []string{"registry.io/app-a:1"}, m[0].RepoTags)
+
+	tag, err := name.NewTag("registry.io/app-c:1")
+	require.NoError(t, err)
+	_, err = tarball.ImageFromPath(paths[1], &tag)
+	assert.NoError(t, err)
+}
+
+func TestWriteArchives_Zstd(t *testing.T) {
+	dir := t.TempDir()
+	imgs := randomImages(t, "registry.io/app-a:1")
+
+	paths, err := WriteArchives(imgs, dir, ArchiveFormatTarZstd, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "rke2-images-edge.linux-amd64.tar.zst")}, paths)
+
+	f, err := os.Open(paths[0])
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	raw := filepath.Join(dir, "raw.tar")
+	out, err := os.Create(raw)
+	require.NoError(t, err)
+	_, err = io.Copy(out, zr)
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+
+	m, err := tarball.LoadManifest(func() (io.ReadCloser, error) { return os.Open(raw) })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"registry.io/app-a:1"}, m[0].RepoTags)
+}
+
+func TestWriteArchives_InvalidFormat(t *testing.T) {
+	_, err := WriteArchives(nil, t.TempDir(), "zip", 0)
+	assert.Error(t, err)
+}
+
+func TestWriteArchives_NotDownloaded(t *testing.T) {
+	reg := registry.New("auth.json", "registry.io", "", false)
+	_, err := WriteArchives([]*Images{New("registry.io/app-a:1", reg)}, t.TempDir(), ArchiveFormatTar, 0)
+	assert.Error(t, err)
+}
+
+func TestLoadArchive_Zstd(t *testing.T) {
+	dir := t.TempDir()
+	imgs := randomImages(t, "docker.io/rancher/hardened-etcd:v3.5", "docker.io/rancher/hardened-coredns:v1.11")
+	paths, err := WriteArchives(imgs, dir, ArchiveFormatTarZstd, 0)
+	require.NoError(t, err)
+
+	reg := registry.New("auth.json", "registry.io", "", false)
+	loaded, cleanup, err := LoadArchive(paths[0], reg)
+	require.NoError(t, err)
+	defer cleanup()
+
+	require.Len(t, loaded, 2)
+	for _, l := range loaded {
+		assert.Equal(t, reg, l.reg)
+		if l.Name != "docker.io/rancher/hardened-etcd:v3.5" {
+			continue
+		}
+		want, err := imgs[0].ImageRef.ConfigName()
+		require.NoError(t, err)
+		got, err := l.ImageRef.ConfigName()
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestLoadArchive_NotDockerArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rke2.linux-amd64.tar")
+	require.NoError(t, os.WriteFile(path, []byte("not a tarball"), 0644))
+
+	_, cleanup, err := LoadArchive(path, nil)
+	defer cleanup()
+	assert.ErrorIs(t, err, ErrNotDockerArchive)
+}
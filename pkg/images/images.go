@@ -1,23 +1,31 @@
 package images
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"sync"
 
+	"github.com/alknopfler/seactl/pkg/progress"
 	"github.com/alknopfler/seactl/pkg/registry"
-	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/alknopfler/seactl/pkg/transport"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
+const (
+	// AnnotationRefName is the OCI annotation holding the original image reference in the layout index
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+	// AnnotationContainerdName is the annotation used by containerd (ctr import) to name the image
+	AnnotationContainerdName = "io.containerd.image.name"
+)
+
 type Images struct {
 	Name     string
-	Insecure bool // If true, skip TLS verification
 	reg      *registry.Registry
 	ImageRef v1.Image
 }
@@ -25,6 +33,9 @@ type Images struct {
 var (
 	remoteImage = remote.Image
 	remoteWrite = remote.Write
+
+	// layoutMu serializes the updates of the layout index.json
+	layoutMu sync.Mutex
 )
 
 func New(name string, reg *registry.Registry) *Images {
@@ -38,20 +49,18 @@ func New(name string, reg *registry.Registry) *Images {
 func (i *Images) Download() error {
 	ref, err := name.ParseReference(i.Name)
 	if err != nil {
-		log.Printf("failed to parse image reference %v", err)
+		slog.Error("failed to parse image reference", "image", i.Name, "error", err)
 		return err
 	}
 
-	fmt.Println(ref)
-
-	img, err := remoteImage(ref)
+	img, err := remoteImage(ref, remote.WithTransport(transport.Source()), remote.WithAuthFromKeychain(transport.SourceKeychain()))
 	if err != nil {
-		log.Printf("pulling image %q: %v", img, err)
+		slog.Error("failed to pull image", "image", i.Name, "error", err)
 		return err
 	}
 
 	i.ImageRef = img
-	log.Printf("successfully pulled image %q", img)
+	slog.Info("image pulled", "image", i.Name)
 	return nil
 }
 
@@ -71,74 +80,132 @@ func (i *Images) Upload() error {
 		return fmt.Errorf("building target reference for %q: %v", i.Name, err)
 	}
 
-	opts, err := i.getRemoteOpts()
+	task := progress.Default().Task(i.Name)
+	defer task.Done()
+
+	opts, err := i.getRemoteOpts(task)
 	if err != nil {
 		return fmt.Errorf("getting remote options: %v", err)
 	}
 
-	log.Printf("pushing image to %s", ref.String())
+	slog.Debug("pushing image", "image", i.Name, "target", ref.String())
 	err = remoteWrite(ref, i.ImageRef, opts...)
 	if err != nil {
 		return fmt.Errorf("pushing image %q: %v", i.ImageRef, err)
 	}
 
-	log.Printf("successfully pushed image %q", i.ImageRef)
+	slog.Info("image pushed", "image", i.Name, "target", ref.String())
 	return nil
 }
 
-func (i *Images) buildTargetReference(src name.Reference) (name.Reference, error) {
-	repoPath := src.Context().RepositoryStr()
-	targetRepo := fmt.Sprintf("%s/%s", i.reg.RegistryURL, repoPath)
+// SaveToLayout writes the pulled image into the OCI image-layout at layoutPath, creating it if needed.
+// Blobs already present in the layout are not written again, and an existing entry for the same
+// reference is replaced, so the layout can be shared by all the images of a run.
+func (i *Images) SaveToLayout(layoutPath string) error {
+	ref, err := name.ParseReference(i.Name)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", i.Name, err)
+	}
 
-	switch ref := src.(type) {
-	case name.Tag:
-		return name.NewTag(fmt.Sprintf("%s:%s", targetRepo, ref.TagStr()), name.WeakValidation)
-	case name.Digest:
-		return name.NewDigest(fmt.Sprintf("%s@%s", targetRepo, ref.DigestStr()), name.WeakValidation)
-	default:
-		return name.ParseReference(targetRepo)
+	layoutMu.Lock()
+	defer layoutMu.Unlock()
+
+	p, err := openLayout(layoutPath)
+	if err != nil {
+		return fmt.Errorf("opening OCI layout %s: %v", layoutPath, err)
 	}
-}
 
-func (i *Images) getRemoteOpts() ([]remote.Option, error) {
-	// Create a custom HTTP transport
-	tlsConfig := &tls.Config{}
-
-	if i.Insecure {
-		tlsConfig.InsecureSkipVerify = true
-	} else if i.reg.RegistryCACert != "" {
-		// Load CA certificate
-		caCert, err := os.ReadFile(i.reg.RegistryCACert)
-		if err != nil {
-			return nil, fmt.Errorf("reading CA certificate: %v", err)
-		}
+	annotations := map[string]string{
+		AnnotationRefName:        ref.Name(),
+		AnnotationContainerdName: ref.Name(),
+	}
+	err = p.ReplaceImage(i.ImageRef, match.Annotation(AnnotationRefName, ref.Name()), layout.WithAnnotations(annotations))
+	if err != nil {
+		return fmt.Errorf("writing image %q to OCI layout: %v", i.Name, err)
+	}
 
-		// Create a CA certificate pool
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-		tlsConfig.RootCAs = caCertPool
+	slog.Info("image saved to OCI layout", "image", ref.Name(), "layout", layoutPath)
+	return nil
+}
+
+// openLayout returns the OCI layout at path, initializing an empty one if it does not exist yet
+func openLayout(path string) (layout.Path, error) {
+	p, err := layout.FromPath(path)
+	if err == nil {
+		return p, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
 	}
+	return layout.Write(path, empty.Index)
+}
 
-	transport := &http.Transport{
-		TLSClientConfig: tlsConfig,
+// TargetReference returns the reference of the image in the registry
+func (i *Images) TargetReference() (string, error) {
+	srcRef, err := name.ParseReference(i.Name)
+	if err != nil {
+		return "", fmt.Errorf("parsing reference %q: %v", i.Name, err)
 	}
+	ref, err := i.buildTargetReference(srcRef)
+	if err != nil {
+		return "", err
+	}
+	return ref.String(), nil
+}
 
-	authFile, err := i.reg.GetUserFromAuthFile()
+// Digest returns the digest of the pulled image
+func (i *Images) Digest() (string, error) {
+	if i.ImageRef == nil {
+		return "", fmt.Errorf("image %q not pulled", i.Name)
+	}
+	digest, err := i.ImageRef.Digest()
 	if err != nil {
-		return nil, fmt.Errorf("reading auth file: %v", err)
+		return "", err
 	}
+	return digest.String(), nil
+}
 
-	// Create a registry authenticator
-	auth := &authn.Basic{
-		Username: authFile[0],
-		Password: authFile[1],
+// Size returns the size of the pulled image: manifest, config and compressed layers
+func (i *Images) Size() (int64, error) {
+	if i.ImageRef == nil {
+		return 0, fmt.Errorf("image %q not pulled", i.Name)
+	}
+	manifest, err := i.ImageRef.Manifest()
+	if err != nil {
+		return 0, err
+	}
+	raw, err := i.ImageRef.RawManifest()
+	if err != nil {
+		return 0, err
+	}
+	size := int64(len(raw)) + manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
 	}
+	return size, nil
+}
+
+func (i *Images) buildTargetReference(src name.Reference) (name.Reference, error) {
+	targetRepo := fmt.Sprintf("%s/%s", i.reg.RegistryURL, i.reg.TargetRepository(src.Context()))
 
-	remoteOpts := []remote.Option{
-		remote.WithTransport(transport),
-		remote.WithAuth(auth),
+	switch ref := src.(type) {
+	case name.Tag:
+		return name.NewTag(fmt.Sprintf("%s:%s", targetRepo, ref.TagStr()), name.WeakValidation)
+	case name.Digest:
+		return name.NewDigest(fmt.Sprintf("%s@%s", targetRepo, ref.DigestStr()), name.WeakValidation)
+	default:
+		return name.ParseReference(targetRepo)
 	}
+}
 
-	// Remote options with custom HTTP client and authenticator
-	return remoteOpts, nil
+// getRemoteOpts returns the options shared by every push to the registry: one transport, one set of
+// credentials and the cached registry tokens. When the progress is shown, the push reports its bytes to task.
+func (i *Images) getRemoteOpts(task *progress.Task) ([]remote.Option, error) {
+	if progress.Default().Enabled() {
+		if size, err := i.Size(); err == nil {
+			task.SetTotal(size)
+		}
+		return i.reg.ProgressOptions(task.Add)
+	}
+	return i.reg.RemoteOptions()
 }
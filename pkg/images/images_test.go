@@ -2,13 +2,26 @@ package images
 
 import (
 	"errors"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alknopfler/seactl/pkg/progress"
 	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/transport"
 	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/stretchr/testify/assert"
@@ -50,7 +63,6 @@ func TestNew(t *testing.T) {
 
 	assert.Equal(t, "nginx:latest", img.Name)
 	assert.Equal(t, reg, img.reg)
-	assert.False(t, img.Insecure)
 }
 
 // ------------------------
@@ -176,7 +188,7 @@ func TestGetRemoteOpts_Success(t *testing.T) {
 	reg := registry.New(authFile, "registry.io", "", false)
 	img := New("nginx:latest", reg)
 
-	opts, err := img.getRemoteOpts()
+	opts, err := img.getRemoteOpts(progress.Default().Task(img.Name))
 	assert.NoError(t, err)
 	assert.NotEmpty(t, opts)
 }
@@ -188,7 +200,7 @@ func TestGetRemoteOpts_InvalidCA(t *testing.T) {
 	reg := registry.New(authFile, "registry.io", "missing-ca.crt", false)
 	img := New("nginx:latest", reg)
 
-	opts, err := img.getRemoteOpts()
+	opts, err := img.getRemoteOpts(progress.Default().Task(img.Name))
 	assert.Error(t, err)
 	assert.Nil(t, opts)
 }
@@ -199,7 +211,174 @@ func TestGetRemoteOpts_InvalidAuthFile(t *testing.T) {
 	reg := registry.New("not-found.json", "registry.io", "", false)
 	img := New("nginx:latest", reg)
 
-	opts, err := img.getRemoteOpts()
+	opts, err := img.getRemoteOpts(progress.Default().Task(img.Name))
 	assert.Error(t, err)
 	assert.Nil(t, opts)
 }
+
+// ------------------------
+// Tests de SaveToLayout
+// ------------------------
+
+func TestSaveToLayout_DeduplicatesBlobs(t *testing.T) {
+	setupTest(t)
+
+	dir := filepath.Join(t.TempDir(), "layout")
+	reg := registry.New("auth.json", "registry.io", "", false)
+
+	base, err := random.Image(1024, 2)
+	require.NoError(t, err)
+
+	first := New("registry.io/team/app:1.0", reg)
+	first.ImageRef = base
+	require.NoError(t, first.SaveToLayout(dir))
+
+	// Same image under another reference, and saved twice
+	second := New("registry.io/team/app:latest", reg)
+	second.ImageRef = base
+	require.NoError(t, second.SaveToLayout(dir))
+	require.NoError(t, second.SaveToLayout(dir))
+
+	p, err := layout.FromPath(dir)
+	require.NoError(t, err)
+	ii, err := p.ImageIndex()
+	require.NoError(t, err)
+	idx, err := ii.IndexManifest()
+	require.NoError(t, err)
+
+	require.Len(t, idx.Manifests, 2)
+	assert.Equal(t, "registry.io/team/app:1.0", idx.Manifests[0].Annotations[AnnotationRefName])
+	assert.Equal(t, "registry.io/team/app:latest", idx.Manifests[1].Annotations[AnnotationContainerdName])
+
+	// 2 layers + config + manifest stored only once
+	blobs, err := os.ReadDir(filepath.Join(dir, "blobs", "sha256"))
+	require.NoError(t, err)
+	assert.Len(t, blobs, 4)
+}
+
+func TestSaveToLayout_InvalidRef(t *testing.T) {
+	setupTest(t)
+
+	reg := registry.New("auth.json", "registry.io", "", false)
+	img := New("!bad-ref", reg)
+	img.ImageRef = &fakeImage{}
+
+	err := img.SaveToLayout(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestTargetReference(t *testing.T) {
+	setupTest(t)
+
+	reg := registry.New("", "registry.local:5000", "", false)
+	target, err := New("docker.io/rancher/hardened-etcd:v3.5", reg).TargetReference()
+	require.NoError(t, err)
+	assert.Equal(t, "registry.local:5000/rancher/hardened-etcd:v3.5", target)
+
+	_, err = New("INVALID::", reg).TargetReference()
+	assert.Error(t, err)
+}
+
+func TestDigestAndSize(t *testing.T) {
+	setupTest(t)
+
+	img := New("nginx:latest", registry.New("", "", "", false))
+	_, err := img.Digest()
+	assert.Error(t, err)
+	_, err = img.Size()
+	assert.Error(t, err)
+
+	ri, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	img.ImageRef = ri
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	want, _ := ri.Digest()
+	assert.Equal(t, want.String(), digest)
+
+	size, err := img.Size()
+	require.NoError(t, err)
+	manifest, _ := ri.RawManifest()
+	configSize, _ := ri.RawConfigFile()
+	assert.True(t, size > int64(len(manifest)+len(configSize)+2*1024))
+}
+
+func TestBuildTargetReference_Rewrites(t *testing.T) {
+	reg := registry.New("", "registry.local:5000", "", false)
+	reg.Rewrites = []registry.Rewrite{{From: "registry.suse.com/edge", To: "mirror/edge"}}
+
+	for src, want := range map[string]string{
+		"registry.suse.com/edge/3.1/kubevirt-operator:1.5.2": "registry.local:5000/mirror/edge/3.1/kubevirt-operator:1.5.2",
+		"registry.suse.com/edgex/foo:1.0":                    "registry.local:5000/edgex/foo:1.0",
+		"docker.io/library/nginx:1.27":                       "registry.local:5000/library/nginx:1.27",
+	} {
+		ref, err := name.ParseReference(src)
+		assert.NoError(t, err)
+		target, err := New(src, reg).buildTargetReference(ref)
+		assert.NoError(t, err)
+		assert.Equal(t, want, target.String(), src)
+	}
+}
+
+// tokenRegistry is an in-memory registry behind a bearer token service counting the token exchanges by scope
+func tokenRegistry(t *testing.T) (host string, exchanges func() map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	counts := map[string]int{}
+	backend := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			mu.Lock()
+			counts[r.URL.Query().Get("scope")]++
+			mu.Unlock()
+			w.Write([]byte(`{"token":"secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return strings.TrimPrefix(srv.URL, "http://"), func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		return maps.Clone(counts)
+	}
+}
+
+func TestUpload_ProgressReusesTokens(t *testing.T) {
+	setupTest(t)
+	defer transport.Configure(transport.Settings{})
+	require.NoError(t, transport.Configure(transport.Settings{}))
+
+	orig := progress.Default()
+	defer progress.SetDefault(orig)
+	tracker := progress.New(io.Discard, false, time.Hour)
+	progress.SetDefault(tracker)
+	require.True(t, progress.Default().Enabled())
+
+	host, exchanges := tokenRegistry(t)
+	reg := registry.New("", host, "", false)
+
+	// two images in each of two repositories, pushed with the progress shown
+	for _, src := range []string{"example.com/edge/a:1", "example.com/edge/a:2", "example.com/edge/b:1", "example.com/edge/b:2"} {
+		rnd, err := random.Image(1024, 2)
+		require.NoError(t, err)
+		img := New(src, reg)
+		img.ImageRef = rnd
+		require.NoError(t, img.Upload(), src)
+	}
+
+	for scope, n := range exchanges() {
+		assert.Equal(t, 1, n, "token exchanges for %s", scope)
+	}
+	assert.Len(t, exchanges(), 2)
+	assert.Greater(t, tracker.Stats().Transferred, int64(4*2*1024))
+}
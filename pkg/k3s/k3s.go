@@ -0,0 +1,112 @@
+package k3s
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/alknopfler/seactl/pkg/download"
+)
+
+const (
+	K3SReleaseURL = "https://github.com/k3s-io/k3s/releases/download/"
+	K3SURL        = "https://get.k3s.io"
+
+	// OutputSubDir keeps the K3s artifacts apart from the RKE2 ones, both ship an install.sh and a sha256sum-amd64.txt
+	OutputSubDir = "k3s"
+)
+
+var (
+	listK3SArtifacts = map[string]string{
+		"K3SBinary":       "k3s",
+		"K3SAirgapImages": "k3s-airgap-images-amd64.tar.zst",
+		"K3SSHA256":       "sha256sum-amd64.txt",
+	}
+)
+
+const k3sChecksumsFile = "sha256sum-amd64.txt"
+
+type K3S struct {
+	Version    string
+	OutputDir  string
+	ReleaseURL string
+	InstallURL string
+}
+
+func New(version, outputDir string) *K3S {
+	return &K3S{
+		Version:    version,
+		OutputDir:  outputDir,
+		ReleaseURL: K3SReleaseURL,
+		InstallURL: K3SURL,
+	}
+}
+
+func (k *K3S) Download() error {
+	if k.Version == "" {
+		return fmt.Errorf("no K3s version found in the release manifest")
+	}
+
+	// Create the destination directory if it doesn't exist
+	if err := os.MkdirAll(k.OutputDir, os.ModePerm); err != nil {
+		slog.Error("failed to create destination directory", "dir", k.OutputDir, "error", err)
+		return err
+	}
+
+	// Download the install.sh script
+	if err := download.File(k.InstallURL, "install.sh", download.EnsureTrailingSlash(k.OutputDir)); err != nil {
+		return fmt.Errorf("failed to download the K3s install.sh script: %w", err)
+	}
+
+	// Download the binary, airgap images and checksums for the current release
+	for _, artifact := range listK3SArtifacts {
+		if err := download.File(k.ReleaseURL+download.EscapeVersion(k.Version)+"/"+artifact, artifact, download.EnsureTrailingSlash(k.OutputDir)); err != nil {
+			return fmt.Errorf("failed to download the file %s: %w", artifact, err)
+		}
+	}
+
+	// The binary is installed from the artifacts directory by install.sh, keep it executable
+	return os.Chmod(download.EnsureTrailingSlash(k.OutputDir)+listK3SArtifacts["K3SBinary"], 0755)
+}
+
+// Files returns the names of the release files downloaded to OutputDir, besides install.sh
+func (k *K3S) Files() []string {
+	var files []string
+	for _, artifact := range listK3SArtifacts {
+		files = append(files, artifact)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// DownloadSize returns the total size of the release files, from HEAD requests
+func (k *K3S) DownloadSize() (int64, error) {
+	var total int64
+	for _, artifact := range k.Files() {
+		size, err := download.Size(k.ReleaseURL + download.EscapeVersion(k.Version) + "/" + artifact)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// ChecksumsFile returns the name of the release checksums file
+func (k *K3S) ChecksumsFile() string {
+	return k3sChecksumsFile
+}
+
+func (k *K3S) Verify() error {
+	files := k.Files()
+	if _, err := os.Stat(download.EnsureTrailingSlash(k.OutputDir) + "install.sh"); err != nil {
+		return fmt.Errorf("K3s install.sh not found: %w", err)
+	}
+	return download.VerifyChecksums(k.OutputDir, k3sChecksumsFile, files)
+}
+
+func (k *K3S) Upload() error {
+	// The K3s artifacts are installed from files (INSTALL_K3S_SKIP_DOWNLOAD), nothing is pushed to the registry
+	return nil
+}
@@ -0,0 +1,121 @@
+package k3s
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newReleaseServer serves a fake K3s release: every artifact plus a matching sha256sum file
+func newReleaseServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var sums strings.Builder
+	for _, artifact := range listK3SArtifacts {
+		if artifact != k3sChecksumsFile {
+			fmt.Fprintf(&sums, "%x  %s\n", sha256.Sum256([]byte("content of "+artifact)), artifact)
+		}
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file := filepath.Base(r.URL.Path)
+		switch {
+		case r.URL.Path == "/install":
+			w.Write([]byte("#!/bin/sh"))
+		case !strings.HasPrefix(r.URL.Path, "/v1.30.3%2Bk3s1/") && !strings.HasPrefix(r.URL.Path, "/v1.30.3+k3s1/"):
+			w.WriteHeader(http.StatusNotFound)
+		case file == k3sChecksumsFile:
+			w.Write([]byte(sums.String()))
+		default:
+			w.Write([]byte("content of " + file))
+		}
+	}))
+}
+
+func TestK3S_DownloadAndVerify(t *testing.T) {
+	server := newReleaseServer(t)
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), OutputSubDir)
+	k := New("v1.30.3+k3s1", dir)
+	k.ReleaseURL = server.URL + "/"
+	k.InstallURL = server.URL + "/install"
+
+	if err := k.Download(); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	if err := k.Verify(); err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "k3s"))
+	if err != nil {
+		t.Fatalf("k3s binary not downloaded: %v", err)
+	}
+	if fi.Mode().Perm()&0100 == 0 {
+		t.Errorf("k3s binary should be executable, mode %v", fi.Mode())
+	}
+
+	// A corrupted artifact fails the verification
+	if err := os.WriteFile(filepath.Join(dir, "k3s"), []byte("corrupted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Verify(); err == nil {
+		t.Errorf("Verify() should fail on checksum mismatch")
+	}
+}
+
+func TestK3S_DownloadSize(t *testing.T) {
+	server := newReleaseServer(t)
+	defer server.Close()
+
+	k := New("v1.30.3+k3s1", t.TempDir())
+	k.ReleaseURL = server.URL + "/"
+	size, err := k.DownloadSize()
+	if err != nil {
+		t.Fatalf("DownloadSize() failed: %v", err)
+	}
+	if size == 0 {
+		t.Errorf("DownloadSize() = 0, want the size of the release files")
+	}
+
+	k.Version = "v1.29.0+k3s1"
+	if _, err := k.DownloadSize(); err == nil {
+		t.Errorf("DownloadSize() should fail when the release does not exist")
+	}
+}
+
+func TestK3S_DownloadNoVersion(t *testing.T) {
+	k := New("", t.TempDir())
+	if err := k.Download(); err == nil {
+		t.Errorf("Download() should fail without K3s version")
+	}
+}
+
+func TestK3S_DownloadHTTPError(t *testing.T) {
+	server := newReleaseServer(t)
+	defer server.Close()
+
+	k := New("v1.29.0+k3s1", t.TempDir())
+	k.ReleaseURL = server.URL + "/"
+	k.InstallURL = server.URL + "/install"
+
+	err := k.Download()
+	if err == nil {
+		t.Fatalf("Download() should fail when the release does not exist")
+	}
+	// the download error is kept
+	if !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("Download() error = %v, want the HTTP status", err)
+	}
+}
+
+func TestK3S_VerifyMissingFiles(t *testing.T) {
+	k := New("v1.30.3+k3s1", t.TempDir())
+	if err := k.Verify(); err == nil {
+		t.Errorf("Verify() should fail when files missing")
+	}
+}
@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TwiN/go-color"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// DefaultLevel is the level used until Configure is called
+const DefaultLevel = "info"
+
+var levels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// file is an *os.File, or a writer wrapping one like progress.Writer
+type file interface {
+	Stat() (os.FileInfo, error)
+}
+
+// isTerminal is assignable for testing
+var isTerminal = func(f file) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f file) bool {
+	return isTerminal(f)
+}
+
+// ParseLevel returns the slog level named level: debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	l, ok := levels[strings.ToLower(level)]
+	if !ok {
+		return 0, fmt.Errorf("invalid log level %q, allowed: debug, info, warn or error", level)
+	}
+	return l, nil
+}
+
+// Configure installs the default logger writing to w, the standard log package included so every message
+// of a run shares the level and the format. Colors are only used for the text format when both stdout and
+// w are terminals.
+func Configure(level, format string, w io.Writer) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	colors := false
+	if f, ok := w.(file); ok {
+		colors = isTerminal(os.Stdout) && isTerminal(f)
+	}
+
+	var h slog.Handler
+	switch format {
+	case FormatText:
+		h = NewTextHandler(w, l, colors)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: l})
+		colors = false
+	default:
+		return fmt.Errorf("invalid log format %q, allowed: '%s' or '%s'", format, FormatText, FormatJSON)
+	}
+
+	color.Toggle(colors)
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// TextHandler writes the records as "<date> <time> <LEVEL> <message> key=value...", the format of the
+// standard log package followed by the record level and fields
+type TextHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	colors bool
+	attrs  string // fields added with WithAttrs, already formatted
+	group  string // prefix of the keys added with WithGroup
+}
+
+// NewTextHandler returns a TextHandler writing the records of level or above to w
+func NewTextHandler(w io.Writer, level slog.Leveler, colors bool) *TextHandler {
+	return &TextHandler{mu: &sync.Mutex{}, w: w, level: level, colors: colors}
+}
+
+func (h *TextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *TextHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	}
+	b.WriteString(h.levelString(r.Level))
+	b.WriteByte(' ')
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.group, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *TextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		appendAttr(&b, h.group, a)
+	}
+	clone := *h
+	clone.attrs += b.String()
+	return &clone
+}
+
+func (h *TextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group += name + "."
+	return &clone
+}
+
+func (h *TextHandler) levelString(level slog.Level) string {
+	s := level.String()
+	if !h.colors {
+		return s
+	}
+	switch {
+	case level >= slog.LevelError:
+		return color.InRed(s)
+	case level >= slog.LevelWarn:
+		return color.InYellow(s)
+	case level >= slog.LevelInfo:
+		return color.InGreen(s)
+	default:
+		return color.InGray(s)
+	}
+}
+
+// appendAttr writes " key=value" to b, groups being flattened as group.key=value
+func appendAttr(b *strings.Builder, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		prefix := group
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(b, prefix, ga)
+		}
+		return
+	}
+
+	var value string
+	switch a.Value.Kind() {
+	case slog.KindTime:
+		value = a.Value.Time().Format(time.RFC3339)
+	default:
+		value = a.Value.String()
+	}
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(group + a.Key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
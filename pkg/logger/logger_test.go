@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TwiN/go-color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTest(t *testing.T) {
+	prev := slog.Default()
+	origIsTerminal := isTerminal
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		isTerminal = origIsTerminal
+		color.Toggle(true)
+	})
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestConfigure_JSON(t *testing.T) {
+	setupTest(t)
+
+	var out bytes.Buffer
+	require.NoError(t, Configure("debug", FormatJSON, &out))
+	slog.Debug("image pushed", "image", "docker.io/library/nginx:1.27", "target", "registry.local/library/nginx:1.27")
+	// The standard log package goes through the same handler
+	log.Printf("file downloaded")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "DEBUG", record["level"])
+	assert.Equal(t, "image pushed", record["msg"])
+	assert.Equal(t, "docker.io/library/nginx:1.27", record["image"])
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "file downloaded", record["msg"])
+}
+
+func TestConfigure_Level(t *testing.T) {
+	setupTest(t)
+
+	var out bytes.Buffer
+	require.NoError(t, Configure("warn", FormatText, &out))
+	slog.Info("hidden")
+	slog.Warn("download failed, retrying", "file", "rke2.linux-amd64.tar.gz", "attempt", 1)
+
+	assert.NotContains(t, out.String(), "hidden")
+	assert.Contains(t, out.String(), " WARN download failed, retrying file=rke2.linux-amd64.tar.gz attempt=1\n")
+}
+
+func TestConfigure_Invalid(t *testing.T) {
+	setupTest(t)
+
+	assert.Error(t, Configure("info", "xml", &bytes.Buffer{}))
+	assert.Error(t, Configure("verbose", FormatText, &bytes.Buffer{}))
+}
+
+func TestConfigure_Colors(t *testing.T) {
+	setupTest(t)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	isTerminal = func(file) bool { return true }
+	require.NoError(t, Configure("info", FormatText, f))
+	assert.Equal(t, color.Green+"x"+color.Reset, color.InGreen("x"))
+
+	// stdout redirected to a file or a pipe
+	isTerminal = func(f file) bool { return f != os.Stdout }
+	require.NoError(t, Configure("info", FormatText, f))
+	assert.Equal(t, "x", color.InGreen("x"))
+
+	// never colored in JSON
+	isTerminal = func(file) bool { return true }
+	require.NoError(t, Configure("info", FormatJSON, f))
+	assert.Equal(t, "x", color.InGreen("x"))
+}
+
+func TestTextHandler(t *testing.T) {
+	var out bytes.Buffer
+	l := slog.New(NewTextHandler(&out, slog.LevelInfo, false)).With("chart", "rancher").WithGroup("helm")
+	l.Info("chart pushed", "version", "2.9.1", "registry", "", "error", "exit status 1")
+
+	line := out.String()
+	assert.Regexp(t, `^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} INFO chart pushed`, line)
+	assert.Contains(t, line, `chart=rancher helm.version=2.9.1 helm.registry="" helm.error="exit status 1"`)
+}
+
+func TestTextHandler_Colors(t *testing.T) {
+	var out bytes.Buffer
+	slog.New(NewTextHandler(&out, slog.LevelDebug, true)).Error("failed")
+	assert.Contains(t, out.String(), color.Red+"ERROR"+color.Reset)
+}
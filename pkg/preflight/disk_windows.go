@@ -0,0 +1,10 @@
+//go:build windows
+
+package preflight
+
+import "errors"
+
+// diskFree is not implemented on windows, the check is reported as a warning
+func diskFree(path string) (int64, error) {
+	return 0, errors.New("free disk space check not supported on windows")
+}
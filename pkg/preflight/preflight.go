@@ -0,0 +1,428 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TwiN/go-color"
+	"github.com/alknopfler/seactl/pkg/airgap"
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/k3s"
+	"github.com/alknopfler/seactl/pkg/progress"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/rke2"
+	"github.com/alknopfler/seactl/pkg/transport"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	StatusOK   = "OK"
+	StatusWarn = "WARN"
+	StatusFail = "FAIL"
+	StatusSkip = "SKIP"
+
+	// EstimatedRKE2Size is used when the size of the RKE2 release files cannot be queried
+	EstimatedRKE2Size int64 = 4 << 30
+	// EstimatedK3SSize is used when the size of the K3s release files cannot be queried
+	EstimatedK3SSize int64 = 1 << 30
+	// spaceMargin is the extra free space required on top of the RKE2/K3s artifacts (helm charts, archives...)
+	spaceMargin = 1.2
+)
+
+// Options are the settings of the run to check, the same as generate
+type Options struct {
+	ReleaseVersion string
+	ReleaseMode    string
+	Registry       *registry.Registry
+	OutputDir      string
+	Components     []string // components of the run, airgap.Component*
+	ChartImages    bool     // the images are selected by rendering the helm charts
+	RKE2ReleaseURL string
+	RKE2InstallURL string
+	RKE2CNIs       []string
+	ReachTimeout   time.Duration
+}
+
+// Result is an item of the checklist
+type Result struct {
+	Name   string
+	Status string
+	Detail string
+	Hint   string // remediation, for WARN and FAIL
+}
+
+var (
+	lookPath           = exec.LookPath
+	readAirgapManifest = config.ReadAirgapManifest
+	freeSpace          = diskFree
+	rke2DownloadSize   = func(r *rke2.RKE2) (int64, error) { return r.DownloadSize() }
+	k3sDownloadSize    = func(k *k3s.K3S) (int64, error) { return k.DownloadSize() }
+)
+
+// Run runs every check and returns the checklist, it never stops at the first failure
+func Run(opts Options) []Result {
+	if opts.ReachTimeout == 0 {
+		opts.ReachTimeout = 15 * time.Second
+	}
+	var results []Result
+	results = append(results, checkTool("podman", ociReleaseSource(opts.ReleaseMode), "the release manifests are not pulled from a container image",
+		"podman pulls the release manifest container: install it, e.g. zypper install podman"))
+	results = append(results, checkTool("helm", airgap.UsesHelm(opts.Components, opts.ChartImages), "no helm component and no --chart-images",
+		"helm mirrors the charts and renders them for --chart-images: install Helm 3, see https://helm.sh/docs/intro/install/"))
+	results = append(results, checkAuthFile(opts.Registry))
+
+	manifest, images, result := checkReleaseManifest(opts)
+	results = append(results, result)
+
+	rke2Version, k3sVersion := "", ""
+	if manifest != nil {
+		rke2Version = manifest.Spec.Components.Kubernetes.Rke2.Version
+		k3sVersion = manifest.Spec.Components.Kubernetes.K3S.Version
+	}
+	var r *rke2.RKE2
+	var k *k3s.K3S
+	var dists []distribution
+	if slices.Contains(opts.Components, airgap.ComponentRKE2) {
+		r = rke2.New(rke2Version, opts.OutputDir, nil)
+		r.CNIs = opts.RKE2CNIs
+		if opts.RKE2ReleaseURL != "" {
+			r.ReleaseURL = opts.RKE2ReleaseURL
+		}
+		if opts.RKE2InstallURL != "" {
+			r.InstallURL = opts.RKE2InstallURL
+		}
+		dists = append(dists, rke2Distribution(r, rke2Version != ""))
+	}
+	if slices.Contains(opts.Components, airgap.ComponentK3S) {
+		k = k3s.New(k3sVersion, opts.OutputDir)
+		dists = append(dists, k3sDistribution(k, k3sVersion != ""))
+	}
+
+	for _, target := range sourceTargets(opts, r, k, images) {
+		results = append(results, checkReachable(target, opts.ReachTimeout))
+	}
+
+	results = append(results, checkTargetRegistry(opts.Registry))
+	results = append(results, checkOutputDir(opts.OutputDir))
+	results = append(results, checkDiskSpace(opts.OutputDir, dists))
+	return results
+}
+
+// Failed returns the number of failed checks
+func Failed(results []Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Status == StatusFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Print writes the checklist to w
+func Print(w io.Writer, results []Result) {
+	for _, r := range results {
+		status := r.Status
+		switch r.Status {
+		case StatusOK:
+			status = color.InGreen(status)
+		case StatusWarn:
+			status = color.InYellow(status)
+		case StatusFail:
+			status = color.InRed(status)
+		}
+		fmt.Fprintf(w, "[%s] %s", status, r.Name)
+		if r.Detail != "" {
+			fmt.Fprintf(w, ": %s", r.Detail)
+		}
+		fmt.Fprintln(w)
+		if r.Hint != "" && (r.Status == StatusFail || r.Status == StatusWarn) {
+			fmt.Fprintf(w, "       hint: %s\n", r.Hint)
+		}
+	}
+}
+
+// checkTool looks for tool in the PATH when required, skipReason tells why it is not
+func checkTool(tool string, required bool, skipReason, hint string) Result {
+	name := tool + " available"
+	if !required {
+		return Result{Name: name, Status: StatusSkip, Detail: "not needed: " + skipReason}
+	}
+	path, err := lookPath(tool)
+	if err != nil {
+		return Result{Name: name, Status: StatusFail, Detail: err.Error(), Hint: hint}
+	}
+	return Result{Name: name, Status: StatusOK, Detail: path}
+}
+
+func checkAuthFile(reg *registry.Registry) Result {
+	name := "registry auth file"
+	if reg == nil || reg.RegistryAuthFile == "" {
+		return Result{Name: name, Status: StatusSkip, Detail: "no --registry-authfile, anonymous access"}
+	}
+	auth, err := reg.GetUserFromAuthFile()
+	if err != nil {
+		return Result{Name: name, Status: StatusFail, Detail: err.Error(),
+			Hint: "the file must contain base64(user):base64(password), e.g. echo -n \"$(echo -n user | base64):$(echo -n pass | base64)\" > auth.txt"}
+	}
+	return Result{Name: name, Status: StatusOK, Detail: fmt.Sprintf("credentials for user %q", auth[0])}
+}
+
+func checkReleaseManifest(opts Options) (*config.ReleaseManifest, *config.ImagesManifest, Result) {
+	name := "release manifest"
+	image, err := config.ReleaseManifestLocation(opts.ReleaseVersion, opts.ReleaseMode)
+	if err != nil {
+		return nil, nil, Result{Name: name, Status: StatusFail, Detail: err.Error(),
+			Hint: "use --release-mode factory, production or a release source defined with --release-source"}
+	}
+	manifest, images, err := readAirgapManifest(opts.ReleaseVersion, opts.ReleaseMode)
+	if err != nil {
+		hint := fmt.Sprintf("check --release-version and --release-mode, and that %s can be read (proxy, --source-cacert)", image)
+		if ociReleaseSource(opts.ReleaseMode) {
+			hint = fmt.Sprintf("check --release-version and --release-mode, and that podman can pull %s (proxy, --source-cacert)", image)
+		}
+		return nil, nil, Result{Name: name, Status: StatusFail, Detail: err.Error(), Hint: hint}
+	}
+	detail := fmt.Sprintf("%s: RKE2 %s, %d images, %d helm charts", image,
+		manifest.Spec.Components.Kubernetes.Rke2.Version, len(images.Images), len(manifest.Spec.Components.Workloads.Helm))
+	return manifest, images, Result{Name: name, Status: StatusOK, Detail: detail}
+}
+
+// target is a source endpoint a run downloads from
+type target struct {
+	name     string
+	url      string
+	registry bool // OCI registry, pinged on /v2/
+}
+
+// sourceTargets returns the release manifest registry, the source image registries and the URLs of the
+// RKE2 and K3s artifacts, r and k being nil when they are not downloaded
+func sourceTargets(opts Options, r *rke2.RKE2, k *k3s.K3S, images *config.ImagesManifest) []target {
+	hosts := map[string]bool{}
+	var manifestServer string
+	if location, err := config.ReleaseManifestLocation(opts.ReleaseVersion, opts.ReleaseMode); err == nil {
+		if ociReleaseSource(opts.ReleaseMode) {
+			if ref, err := name.ParseReference(location); err == nil {
+				hosts[ref.Context().RegistryStr()] = true
+			}
+		} else if strings.HasPrefix(location, "http") {
+			manifestServer = baseURL(location)
+		}
+	}
+	if images != nil {
+		for _, img := range images.Images {
+			if ref, err := name.ParseReference(img.Name); err == nil {
+				hosts[ref.Context().RegistryStr()] = true
+			}
+		}
+	}
+
+	var targets []target
+	if manifestServer != "" {
+		targets = append(targets, target{name: "release manifest server", url: manifestServer})
+	}
+	var sorted []string
+	for host := range hosts {
+		sorted = append(sorted, host)
+	}
+	sort.Strings(sorted)
+	for _, host := range sorted {
+		targets = append(targets, target{name: "source registry " + host, url: "https://" + host + "/v2/", registry: true})
+	}
+
+	if r != nil {
+		targets = append(targets, target{name: "RKE2 release files", url: baseURL(r.ReleaseURL)})
+		installURL := r.InstallURL
+		if strings.Contains(installURL, "{{") {
+			installURL = baseURL(installURL)
+		}
+		targets = append(targets, target{name: "RKE2 install script", url: installURL})
+	}
+	if k != nil {
+		targets = append(targets, target{name: "K3s release files", url: baseURL(k.ReleaseURL)})
+		targets = append(targets, target{name: "K3s install script", url: k.InstallURL})
+	}
+	return targets
+}
+
+// ociReleaseSource reports whether the release manifests of mode are pulled from a container image, an unknown
+// mode counting as one
+func ociReleaseSource(mode string) bool {
+	source, err := config.LookupReleaseSource(mode)
+	if err != nil {
+		return true
+	}
+	_, ok := source.(*config.OCISource)
+	return ok
+}
+
+// baseURL keeps the scheme and host of u, enough to check the reachability of a (templated) base URL
+func baseURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return u
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/"
+}
+
+// checkReachable sends a HEAD request through the source transport, any HTTP answer means reachable
+func checkReachable(t target, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, t.url, nil)
+	if err != nil {
+		return Result{Name: t.name, Status: StatusFail, Detail: err.Error(), Hint: "check the URL"}
+	}
+	resp, err := (&http.Client{Transport: transport.Source()}).Do(req)
+	if err != nil {
+		if isTLS(err) {
+			return Result{Name: t.name, Status: StatusFail, Detail: err.Error(),
+				Hint: "the server certificate is not trusted: add the CA (e.g. of a TLS intercepting proxy) with --source-cacert"}
+		}
+		return Result{Name: t.name, Status: StatusFail, Detail: err.Error(),
+			Hint: "check the network access, DNS and the proxy settings (HTTPS_PROXY, NO_PROXY or --proxy)"}
+	}
+	resp.Body.Close()
+
+	if t.registry && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return Result{Name: t.name, Status: StatusWarn, Detail: fmt.Sprintf("%s answered %s", t.url, resp.Status),
+			Hint: "the host answers but does not look like a registry, check the proxy settings"}
+	}
+	return Result{Name: t.name, Status: StatusOK, Detail: fmt.Sprintf("%s (%s)", t.url, resp.Status)}
+}
+
+func isTLS(err error) bool {
+	return strings.Contains(err.Error(), "x509: ") || strings.Contains(err.Error(), "tls: ")
+}
+
+func checkTargetRegistry(reg *registry.Registry) Result {
+	name := "target registry"
+	if reg == nil || reg.RegistryURL == "" {
+		return Result{Name: name, Status: StatusSkip, Detail: "no --registry-url"}
+	}
+	name += " " + reg.RegistryURL
+	err := reg.RegistryLogin()
+	if err == nil {
+		return Result{Name: name, Status: StatusOK, Detail: "reachable, TLS trusted, authenticated and allowed to push"}
+	}
+
+	hint := "check the registry URL"
+	switch {
+	case errors.Is(err, registry.ErrNetwork):
+		hint = "check the registry URL, the DNS and NO_PROXY/--proxy (the private registry is usually not behind the proxy)"
+	case errors.Is(err, registry.ErrTLS):
+		hint = "add the registry CA with --registry-cacert, the client certificate with --registry-cert/--registry-key, or use --insecure"
+	case errors.Is(err, registry.ErrAuth):
+		hint = "check the user and password of --registry-authfile"
+	case errors.Is(err, registry.ErrPermission):
+		hint = fmt.Sprintf("grant push permission to the user on %s (the project or namespace must exist)", reg.RegistryURL)
+	}
+	return Result{Name: name, Status: StatusFail, Detail: err.Error(), Hint: hint}
+}
+
+func checkOutputDir(dir string) Result {
+	name := "output directory writable"
+	if dir == "" {
+		return Result{Name: name, Status: StatusSkip, Detail: "no --output"}
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return Result{Name: name, Status: StatusFail, Detail: err.Error(), Hint: "use a directory the current user can create and write"}
+	}
+	f, err := os.CreateTemp(dir, ".seactl-preflight-*")
+	if err != nil {
+		return Result{Name: name, Status: StatusFail, Detail: err.Error(), Hint: "fix the permissions of " + dir}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return Result{Name: name, Status: StatusOK, Detail: dir}
+}
+
+// distribution are the release files of a Kubernetes distribution downloaded to the output directory
+type distribution struct {
+	name     string
+	size     func() (int64, error) // nil when the version is unknown
+	estimate int64                 // used when the size cannot be queried
+}
+
+func rke2Distribution(r *rke2.RKE2, knownVersion bool) distribution {
+	d := distribution{name: "RKE2", estimate: EstimatedRKE2Size}
+	if knownVersion {
+		d.size = func() (int64, error) { return rke2DownloadSize(r) }
+	}
+	return d
+}
+
+func k3sDistribution(k *k3s.K3S, knownVersion bool) distribution {
+	d := distribution{name: "K3s", estimate: EstimatedK3SSize}
+	if knownVersion {
+		d.size = func() (int64, error) { return k3sDownloadSize(k) }
+	}
+	return d
+}
+
+func checkDiskSpace(dir string, dists []distribution) Result {
+	name := "free disk space"
+	if dir == "" {
+		return Result{Name: name, Status: StatusSkip, Detail: "no --output"}
+	}
+	if len(dists) == 0 {
+		return Result{Name: name, Status: StatusSkip, Detail: "no RKE2 or K3s artifacts to download"}
+	}
+
+	var required int64
+	var names []string
+	estimated := false
+	for _, d := range dists {
+		names = append(names, d.name)
+		size, known := d.estimate, false
+		if d.size != nil {
+			if s, err := d.size(); err == nil {
+				size, known = s, true
+			}
+		}
+		estimated = estimated || !known
+		required += size
+	}
+	required = int64(float64(required) * spaceMargin)
+
+	free, err := freeSpace(existingParent(dir))
+	if err != nil {
+		return Result{Name: name, Status: StatusWarn, Detail: err.Error(), Hint: "check the free space manually"}
+	}
+
+	detail := fmt.Sprintf("%s free in %s, %s artifacts need %s", progress.FormatBytes(free), dir, strings.Join(names, " and "), progress.FormatBytes(required))
+	if estimated {
+		detail += " (estimated)"
+	}
+	if free < required {
+		return Result{Name: name, Status: StatusFail, Detail: detail,
+			Hint: "free some space or use another --output, --rke2-cni reduces the size of the RKE2 artifacts"}
+	}
+	return Result{Name: name, Status: StatusOK, Detail: detail}
+}
+
+// existingParent returns dir or its closest existing parent, for the free space of a directory not created yet
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,246 @@
+package preflight
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/k3s"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/alknopfler/seactl/pkg/rke2"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	origLookPath           = lookPath
+	origReadAirgapManifest = readAirgapManifest
+	origFreeSpace          = freeSpace
+	origRKE2DownloadSize   = rke2DownloadSize
+	origK3SDownloadSize    = k3sDownloadSize
+)
+
+func setupTest(t *testing.T) {
+	t.Cleanup(func() {
+		lookPath = origLookPath
+		readAirgapManifest = origReadAirgapManifest
+		freeSpace = origFreeSpace
+		rke2DownloadSize = origRKE2DownloadSize
+		k3sDownloadSize = origK3SDownloadSize
+	})
+}
+
+func TestCheckTool(t *testing.T) {
+	setupTest(t)
+
+	lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	assert.Equal(t, StatusOK, checkTool("helm", true, "no charts", "install helm").Status)
+	res := checkTool("helm", false, "no charts", "install helm")
+	assert.Equal(t, StatusSkip, res.Status)
+	assert.Equal(t, "not needed: no charts", res.Detail)
+
+	lookPath = func(file string) (string, error) { return "", errors.New("not found") }
+	res = checkTool("helm", true, "no charts", "install helm")
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Equal(t, "install helm", res.Hint)
+}
+
+func TestCheckAuthFile(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth")
+	require.NoError(t, os.WriteFile(authFile, []byte("dXNlcg==:cGFzcw=="), 0600))
+	badFile := filepath.Join(t.TempDir(), "bad")
+	require.NoError(t, os.WriteFile(badFile, []byte("not-base64!"), 0600))
+
+	assert.Equal(t, StatusSkip, checkAuthFile(registry.New("", "reg", "", false)).Status)
+	assert.Equal(t, StatusOK, checkAuthFile(registry.New(authFile, "reg", "", false)).Status)
+
+	res := checkAuthFile(registry.New(badFile, "reg", "", false))
+	assert.Equal(t, StatusFail, res.Status)
+	assert.NotEmpty(t, res.Hint)
+}
+
+func TestCheckReleaseManifest(t *testing.T) {
+	setupTest(t)
+
+	readAirgapManifest = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		m := &config.ReleaseManifest{}
+		m.Spec.Components.Kubernetes.Rke2.Version = "v1.30.3+rke2r1"
+		return m, &config.ImagesManifest{}, nil
+	}
+	manifest, _, res := checkReleaseManifest(Options{ReleaseVersion: "3.1.0", ReleaseMode: "factory"})
+	assert.Equal(t, StatusOK, res.Status)
+	assert.Contains(t, res.Detail, "v1.30.3+rke2r1")
+	assert.NotNil(t, manifest)
+
+	_, _, res = checkReleaseManifest(Options{ReleaseVersion: "3.1.0", ReleaseMode: "invalid"})
+	assert.Equal(t, StatusFail, res.Status)
+
+	readAirgapManifest = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		return nil, nil, errors.New("failed to pull image")
+	}
+	_, _, res = checkReleaseManifest(Options{ReleaseVersion: "3.1.0", ReleaseMode: "production"})
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Contains(t, res.Hint, "registry.suse.com/edge/3.1/release-manifest:3.1.0")
+}
+
+func TestSourceTargets(t *testing.T) {
+	images := &config.ImagesManifest{}
+	for _, name := range []string{"registry.suse.com/edge/a:1", "docker.io/library/nginx:1", "registry.suse.com/edge/b:1"} {
+		images.Images = append(images.Images, struct {
+			Name string `yaml:"name"`
+		}{Name: name})
+	}
+	r := rke2.New("v1.30.3+rke2r1", "", nil)
+	r.ReleaseURL = "https://mirror.local/rke2/{{.Version}}/"
+
+	var urls []string
+	for _, target := range sourceTargets(Options{ReleaseVersion: "3.1.0", ReleaseMode: "production"}, r, nil, images) {
+		urls = append(urls, target.url)
+	}
+	assert.Equal(t, []string{
+		"https://index.docker.io/v2/",
+		"https://registry.suse.com/v2/",
+		"https://mirror.local/",
+		"https://get.rke2.io",
+	}, urls)
+
+	// the manifests of an HTTP release source come from a web server, not a registry
+	targets := sourceTargets(Options{ReleaseVersion: "3.1.0", ReleaseMode: "https://manifests.local/edge"}, r, nil, nil)
+	assert.Equal(t, target{name: "release manifest server", url: "https://manifests.local/"}, targets[0])
+	assert.False(t, ociReleaseSource("https://manifests.local/edge"))
+
+	// K3s only
+	urls = nil
+	for _, target := range sourceTargets(Options{ReleaseVersion: "3.1.0", ReleaseMode: "production"}, nil, k3s.New("v1.30.3+k3s1", ""), nil) {
+		urls = append(urls, target.url)
+	}
+	assert.Equal(t, []string{
+		"https://registry.suse.com/v2/",
+		"https://github.com/",
+		"https://get.k3s.io",
+	}, urls)
+}
+
+func TestCheckReachable(t *testing.T) {
+	registryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer registryServer.Close()
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+
+	res := checkReachable(target{name: "registry", url: registryServer.URL + "/v2/", registry: true}, time.Second)
+	assert.Equal(t, StatusOK, res.Status)
+
+	// Any answer means a plain URL is reachable, but a registry must answer /v2/
+	res = checkReachable(target{name: "web", url: tlsServer.URL}, time.Second)
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Contains(t, res.Hint, "--source-cacert")
+
+	notRegistry := httptest.NewServer(http.NotFoundHandler())
+	defer notRegistry.Close()
+	assert.Equal(t, StatusOK, checkReachable(target{name: "web", url: notRegistry.URL}, time.Second).Status)
+	assert.Equal(t, StatusWarn, checkReachable(target{name: "registry", url: notRegistry.URL + "/v2/", registry: true}, time.Second).Status)
+
+	notRegistry.Close()
+	res = checkReachable(target{name: "web", url: notRegistry.URL}, time.Second)
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Contains(t, res.Hint, "proxy")
+}
+
+func TestCheckTargetRegistry(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	assert.Equal(t, StatusSkip, checkTargetRegistry(registry.New("", "", "", false)).Status)
+	assert.Equal(t, StatusOK, checkTargetRegistry(registry.New("", strings.TrimPrefix(server.URL, "http://"), "", false)).Status)
+
+	server.Close()
+	res := checkTargetRegistry(registry.New("", strings.TrimPrefix(server.URL, "http://"), "", false))
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Contains(t, res.Hint, "NO_PROXY")
+}
+
+func TestCheckOutputDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "new", "output")
+	assert.Equal(t, StatusOK, checkOutputDir(dir).Status)
+	assert.Equal(t, StatusSkip, checkOutputDir("").Status)
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	assert.Equal(t, StatusFail, checkOutputDir(filepath.Join(file, "output")).Status)
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	setupTest(t)
+	rke2Dist := []distribution{rke2Distribution(rke2.New("v1.30.3+rke2r1", "", nil), true)}
+
+	rke2DownloadSize = func(r *rke2.RKE2) (int64, error) { return 1 << 30, nil }
+	freeSpace = func(path string) (int64, error) { return 2 << 30, nil }
+	res := checkDiskSpace(t.TempDir(), rke2Dist)
+	assert.Equal(t, StatusOK, res.Status)
+	assert.NotContains(t, res.Detail, "estimated")
+
+	freeSpace = func(path string) (int64, error) { return 1 << 30, nil }
+	assert.Equal(t, StatusFail, checkDiskSpace(t.TempDir(), rke2Dist).Status)
+
+	// Unknown sizes fall back to the estimation
+	rke2DownloadSize = func(r *rke2.RKE2) (int64, error) { return 0, errors.New("offline") }
+	freeSpace = func(path string) (int64, error) { return EstimatedRKE2Size * 2, nil }
+	res = checkDiskSpace(t.TempDir(), rke2Dist)
+	assert.Equal(t, StatusOK, res.Status)
+	assert.Contains(t, res.Detail, "estimated")
+
+	freeSpace = func(path string) (int64, error) { return 0, errors.New("statfs failed") }
+	assert.Equal(t, StatusWarn, checkDiskSpace(t.TempDir(), rke2Dist).Status)
+
+	// Nothing to download
+	assert.Equal(t, StatusSkip, checkDiskSpace(t.TempDir(), nil).Status)
+}
+
+func TestCheckDiskSpace_K3S(t *testing.T) {
+	setupTest(t)
+	rke2DownloadSize = func(r *rke2.RKE2) (int64, error) { return 1 << 30, nil }
+	k3sDownloadSize = func(k *k3s.K3S) (int64, error) { return 1 << 29, nil }
+	freeSpace = func(path string) (int64, error) { return 3 << 29, nil }
+
+	k := k3s.New("v1.30.3+k3s1", "")
+	res := checkDiskSpace(t.TempDir(), []distribution{k3sDistribution(k, true)})
+	assert.Equal(t, StatusOK, res.Status)
+	assert.Contains(t, res.Detail, "K3s artifacts need")
+
+	// both distributions are downloaded to the output directory
+	res = checkDiskSpace(t.TempDir(), []distribution{rke2Distribution(rke2.New("v1.30.3+rke2r1", "", nil), true), k3sDistribution(k, true)})
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Contains(t, res.Detail, "RKE2 and K3s artifacts need")
+}
+
+func TestDiskFree(t *testing.T) {
+	free, err := diskFree(t.TempDir())
+	assert.NoError(t, err)
+	assert.True(t, free > 0)
+}
+
+func TestPrintAndFailed(t *testing.T) {
+	results := []Result{
+		{Name: "helm available", Status: StatusOK, Detail: "/usr/bin/helm"},
+		{Name: "target registry", Status: StatusFail, Detail: "denied", Hint: "grant push permission"},
+		{Name: "auth file", Status: StatusSkip},
+	}
+	var out bytes.Buffer
+	Print(&out, results)
+
+	assert.Contains(t, out.String(), "helm available: /usr/bin/helm")
+	assert.Contains(t, out.String(), "hint: grant push permission")
+	assert.Equal(t, 1, Failed(results))
+}
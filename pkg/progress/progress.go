@@ -0,0 +1,375 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is the period of the summary lines when the output is not a terminal
+const DefaultInterval = 30 * time.Second
+
+const (
+	// refreshInterval is the period of the live display redraws
+	refreshInterval = 250 * time.Millisecond
+	// maxTaskLines caps the per-worker status lines of the live display
+	maxTaskLines = 10
+	// rateSmoothing weights the last throughput sample against the previous ones
+	rateSmoothing = 0.3
+)
+
+var (
+	defaultMu sync.Mutex
+	// the default tracker is disabled: it counts, but never prints anything
+	defaultTracker = &Tracker{}
+)
+
+// Default returns the tracker of the run
+func Default() *Tracker {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultTracker
+}
+
+// SetDefault sets the tracker of the run
+func SetDefault(t *Tracker) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultTracker = t
+}
+
+// Tracker aggregates the progress of a run: the items (images, charts, RKE2/K3s artifacts) done out of the
+// total, and the bytes transferred by the running tasks. On a terminal it keeps a live display with one
+// status line per running task, otherwise it logs a summary line every interval.
+type Tracker struct {
+	mu       sync.Mutex
+	out      io.Writer // nil for a disabled tracker
+	live     bool
+	interval time.Duration
+
+	items       int
+	done        int
+	transferred int64
+	tasks       []*Task
+
+	started   time.Time
+	lastTime  time.Time
+	lastBytes int64
+	rate      float64 // bytes per second, smoothed
+
+	lines   int // lines of the live display currently drawn
+	running bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// New returns a tracker printing to out: a live display when live is set, summary lines every interval
+// otherwise
+func New(out io.Writer, live bool, interval time.Duration) *Tracker {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Tracker{out: out, live: live, interval: interval}
+}
+
+// Enabled reports whether the tracker prints the progress
+func (t *Tracker) Enabled() bool {
+	return t.out != nil
+}
+
+// Start starts the live display or the summary lines, until Stop
+func (t *Tracker) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.started = time.Now()
+	t.lastTime = t.started
+	if t.out == nil || t.running {
+		return
+	}
+	t.running = true
+	t.stop = make(chan struct{})
+	t.stopped = make(chan struct{})
+	go t.loop()
+}
+
+// Stop stops the live display or the summary lines, and prints the final summary
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	if !t.running {
+		t.mu.Unlock()
+		return
+	}
+	t.running = false
+	close(t.stop)
+	t.mu.Unlock()
+	<-t.stopped
+
+	t.mu.Lock()
+	t.clearLocked()
+	stats := t.statsLocked(time.Now())
+	t.mu.Unlock()
+	slog.Info("progress", stats.attrs()...)
+}
+
+func (t *Tracker) loop() {
+	defer close(t.stopped)
+
+	period := t.interval
+	if t.live {
+		period = refreshInterval
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			t.mu.Lock()
+			t.sampleLocked(now)
+			if t.live {
+				t.clearLocked()
+				t.drawLocked()
+				t.mu.Unlock()
+				continue
+			}
+			stats := t.statsLocked(now)
+			t.mu.Unlock()
+			// outside the lock, the logs may be written through Writer
+			slog.Info("progress", stats.attrs()...)
+		}
+	}
+}
+
+// AddItems adds n items to the total
+func (t *Tracker) AddItems(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.items += n
+}
+
+// ItemDone counts an item as done, successful or not
+func (t *Tracker) ItemDone() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done++
+}
+
+// Task returns a running task named name, shown on its own status line until Done
+func (t *Tracker) Task(name string) *Task {
+	task := &Task{tracker: t, name: name}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tasks = append(t.tasks, task)
+	return task
+}
+
+// Stats returns the current progress
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.statsLocked(time.Now())
+}
+
+func (t *Tracker) statsLocked(now time.Time) Stats {
+	s := Stats{Items: t.items, Done: t.done, Transferred: t.transferred, Throughput: t.rate}
+	if !t.started.IsZero() {
+		s.Elapsed = now.Sub(t.started)
+	}
+	if s.Throughput == 0 && s.Elapsed > 0 {
+		s.Throughput = float64(t.transferred) / s.Elapsed.Seconds()
+	}
+	// The sizes of the items are not known upfront, the ETA comes from the pace of the items done
+	if s.Done > 0 && s.Done < s.Items {
+		s.ETA = time.Duration(float64(s.Elapsed) / float64(s.Done) * float64(s.Items-s.Done))
+	}
+	return s
+}
+
+func (t *Tracker) sampleLocked(now time.Time) {
+	elapsed := now.Sub(t.lastTime).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	sample := float64(t.transferred-t.lastBytes) / elapsed
+	if t.rate == 0 {
+		t.rate = sample
+	} else {
+		t.rate = rateSmoothing*sample + (1-rateSmoothing)*t.rate
+	}
+	t.lastTime, t.lastBytes = now, t.transferred
+}
+
+// drawLocked prints the live display: the aggregate progress and a status line per running task
+func (t *Tracker) drawLocked() {
+	if !t.live || !t.running {
+		return
+	}
+	lines := []string{"Progress: " + t.statsLocked(time.Now()).String()}
+	for i, task := range t.tasks {
+		if i == maxTaskLines {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(t.tasks)-maxTaskLines))
+			break
+		}
+		lines = append(lines, "  "+task.String())
+	}
+	fmt.Fprint(t.out, strings.Join(lines, "\n")+"\n")
+	t.lines = len(lines)
+}
+
+// clearLocked erases the live display, the cursor being left where it started
+func (t *Tracker) clearLocked() {
+	if t.lines == 0 {
+		return
+	}
+	fmt.Fprint(t.out, strings.Repeat("\033[1A\033[2K", t.lines))
+	t.lines = 0
+}
+
+func (t *Tracker) removeLocked(task *Task) {
+	for i, running := range t.tasks {
+		if running == task {
+			t.tasks = append(t.tasks[:i], t.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Task is a running transfer, e.g. an image push or a file download
+type Task struct {
+	tracker  *Tracker
+	name     string
+	complete int64
+	total    int64
+}
+
+// SetTotal sets the size of the transfer, when known
+func (task *Task) SetTotal(total int64) {
+	task.tracker.mu.Lock()
+	defer task.tracker.mu.Unlock()
+	task.total = total
+}
+
+// Add adds n bytes transferred
+func (task *Task) Add(n int64) {
+	task.tracker.mu.Lock()
+	defer task.tracker.mu.Unlock()
+	task.complete += n
+	task.tracker.transferred += n
+}
+
+// Resume sets the bytes already transferred by a previous run, they are not counted as transferred
+func (task *Task) Resume(offset int64) {
+	task.tracker.mu.Lock()
+	defer task.tracker.mu.Unlock()
+	task.complete = offset
+}
+
+// Reader returns r counting the bytes read as transferred
+func (task *Task) Reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, task: task}
+}
+
+// Done removes the task from the running ones
+func (task *Task) Done() {
+	task.tracker.mu.Lock()
+	defer task.tracker.mu.Unlock()
+	task.tracker.removeLocked(task)
+}
+
+// String returns the status line of the task, called with the tracker locked
+func (task *Task) String() string {
+	if task.total > 0 {
+		return fmt.Sprintf("%s: %s / %s", task.name, FormatBytes(task.complete), FormatBytes(task.total))
+	}
+	return fmt.Sprintf("%s: %s", task.name, FormatBytes(task.complete))
+}
+
+type countingReader struct {
+	r    io.Reader
+	task *Task
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.task.Add(int64(n))
+	}
+	return n, err
+}
+
+// Stats is the aggregate progress of a run
+type Stats struct {
+	Items       int
+	Done        int
+	Transferred int64
+	Throughput  float64 // bytes per second
+	Elapsed     time.Duration
+	ETA         time.Duration // 0 when unknown
+}
+
+func (s Stats) String() string {
+	str := fmt.Sprintf("%d/%d items, %s transferred, %s/s", s.Done, s.Items, FormatBytes(s.Transferred), FormatBytes(int64(s.Throughput)))
+	if s.ETA > 0 {
+		str += ", ETA " + s.ETA.Round(time.Second).String()
+	}
+	return str
+}
+
+func (s Stats) attrs() []any {
+	attrs := []any{
+		"items", fmt.Sprintf("%d/%d", s.Done, s.Items),
+		"transferred", FormatBytes(s.Transferred),
+		"throughput", FormatBytes(int64(s.Throughput)) + "/s",
+		"elapsed", s.Elapsed.Round(time.Second).String(),
+	}
+	if s.ETA > 0 {
+		attrs = append(attrs, "eta", s.ETA.Round(time.Second).String())
+	}
+	return attrs
+}
+
+// FormatBytes returns n in a human readable unit, e.g. 1.5 GiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Writer is the output shared by the logs and the live display: the display is cleared before every
+// write and drawn again after it, so the log lines scroll above the display
+type Writer struct {
+	*os.File
+}
+
+// NewWriter returns a Writer on f
+func NewWriter(f *os.File) *Writer {
+	return &Writer{File: f}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	t := Default()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.live || !t.running {
+		return w.File.Write(p)
+	}
+	t.clearLocked()
+	n, err := w.File.Write(p)
+	t.drawLocked()
+	return n, err
+}
@@ -0,0 +1,142 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of the tracker goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func captureLogs(t *testing.T) *syncBuffer {
+	logs := &syncBuffer{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return logs
+}
+
+func TestTracker_Stats(t *testing.T) {
+	tr := New(io.Discard, false, time.Minute)
+	tr.AddItems(4)
+	tr.started = time.Now().Add(-10 * time.Second)
+
+	task := tr.Task("docker.io/library/nginx:1.27")
+	task.SetTotal(300)
+	task.Add(250)
+	task.Resume(50) // a retry resuming a partial transfer is not counted twice
+	task.Add(10)
+	tr.ItemDone()
+
+	stats := tr.Stats()
+	assert.Equal(t, 4, stats.Items)
+	assert.Equal(t, 1, stats.Done)
+	assert.Equal(t, int64(260), stats.Transferred)
+	assert.InDelta(t, 26, stats.Throughput, 1)
+	assert.InDelta(t, 30*time.Second, stats.ETA, float64(time.Second))
+	assert.Equal(t, "docker.io/library/nginx:1.27: 60 B / 300 B", task.String())
+
+	task.Resume(1000)
+	assert.Equal(t, int64(260), tr.Stats().Transferred)
+}
+
+func TestTracker_Disabled(t *testing.T) {
+	tr := &Tracker{}
+	assert.False(t, tr.Enabled())
+	tr.Start()
+	tr.Task("file").Add(10)
+	tr.Stop()
+	assert.Equal(t, int64(10), tr.Stats().Transferred)
+}
+
+func TestTracker_Live(t *testing.T) {
+	captureLogs(t)
+	var out bytes.Buffer
+	tr := New(&out, true, time.Minute)
+	tr.AddItems(2)
+	tr.Start()
+
+	task := tr.Task("rke2.linux-amd64.tar.gz")
+	task.SetTotal(2048)
+	task.Add(1024)
+	require.Eventually(t, func() bool {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		return strings.Contains(out.String(), "rke2.linux-amd64.tar.gz: 1.0 KiB / 2.0 KiB")
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, out.String(), "Progress: 0/2 items, 1.0 KiB transferred")
+
+	task.Done()
+	tr.Stop()
+	// the display is erased when the run ends
+	assert.True(t, strings.HasSuffix(out.String(), "\033[1A\033[2K"))
+}
+
+func TestTracker_Summary(t *testing.T) {
+	logs := captureLogs(t)
+	tr := New(io.Discard, false, 10*time.Millisecond)
+	tr.AddItems(3)
+	tr.Start()
+	tr.ItemDone()
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), "msg=progress items=1/3")
+	}, time.Second, 10*time.Millisecond)
+	tr.Stop()
+}
+
+func TestWriter(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	tr := New(f, true, time.Minute)
+	tr.running = true
+	orig := Default()
+	SetDefault(tr)
+	defer SetDefault(orig)
+
+	tr.mu.Lock()
+	tr.drawLocked()
+	tr.mu.Unlock()
+
+	w := NewWriter(f)
+	_, err = w.Write([]byte("log line\n"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	// display, erased, the log line, display again
+	assert.Equal(t, "Progress: 0/0 items, 0 B transferred, 0 B/s\n\033[1A\033[2Klog line\nProgress: 0/0 items, 0 B transferred, 0 B/s\n", string(data))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", FormatBytes(512))
+	assert.Equal(t, "1.5 KiB", FormatBytes(1536))
+	assert.Equal(t, "4.0 GiB", FormatBytes(4<<30))
+}
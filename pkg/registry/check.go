@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// ProbeRepository is the scratch repository, under the registry URL, used to check the push permission.
+// The upload is cancelled right away, nothing is written to it.
+const ProbeRepository = "seactl-probe"
+
+// Errors returned by RegistryLogin, to tell which part of the registry setup is wrong
+var (
+	ErrAuth       = errors.New("authentication failed, check the credentials of the auth file")
+	ErrTLS        = errors.New("TLS verification failed, check --registry-cacert, --registry-cert/--registry-key or use --insecure")
+	ErrPermission = errors.New("push permission denied, check the permissions of the user on the registry")
+	ErrNetwork    = errors.New("registry unreachable, check the registry URL and the proxy settings")
+)
+
+var remoteCheckPushPermission = remote.CheckPushPermission
+
+// staticKeychain resolves every registry to the same credentials
+type staticKeychain struct {
+	auth authn.Authenticator
+}
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) { return k.auth, nil }
+
+// ping checks the /v2/ endpoint answers like a registry, over https first and then over http for the
+// registries go-containerregistry talks to in plain http (localhost, private networks)
+func ping(ctx context.Context, reg name.Registry, rt http.RoundTripper) error {
+	schemes := []string{"https"}
+	if reg.Scheme() == "http" {
+		schemes = append(schemes, "http")
+	}
+
+	client := &http.Client{Transport: rt}
+	var errs []error
+	for _, scheme := range schemes {
+		url := fmt.Sprintf("%s://%s/v2/", scheme, reg.RegistryStr())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp.Body.Close()
+
+		// 401 is the expected answer of a registry requiring authentication
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnauthorized {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("GET %s: unexpected status %s", url, resp.Status))
+	}
+
+	// A TLS failure on https hides behind the http fallback error, report it first
+	for _, err := range errs {
+		if isTLSError(err) {
+			return fmt.Errorf("%w: %v", ErrTLS, err)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrNetwork, errors.Join(errs...))
+}
+
+// probePush initiates (and cancels) a blob upload to ProbeRepository with the registry credentials
+func (r *Registry) probePush(repo name.Repository) error {
+	err := remoteCheckPushPermission(repo.Tag("probe"), staticKeychain{r.auth}, r.rt)
+	if err == nil {
+		return nil
+	}
+	return classify(err)
+}
+
+// classify wraps err with the matching ErrAuth, ErrTLS, ErrPermission or ErrNetwork
+func classify(err error) error {
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		switch terr.StatusCode {
+		case http.StatusUnauthorized:
+			return fmt.Errorf("%w: %v", ErrAuth, err)
+		case http.StatusForbidden, http.StatusNotFound:
+			// 404: the project or namespace of the registry URL does not exist for this user
+			return fmt.Errorf("%w: %v", ErrPermission, err)
+		}
+		for _, d := range terr.Errors {
+			switch d.Code {
+			case transport.UnauthorizedErrorCode:
+				return fmt.Errorf("%w: %v", ErrAuth, err)
+			case transport.DeniedErrorCode:
+				return fmt.Errorf("%w: %v", ErrPermission, err)
+			}
+		}
+	}
+	if isTLSError(err) {
+		return fmt.Errorf("%w: %v", ErrTLS, err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %v", ErrNetwork, err)
+	}
+	return err
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		verification     *tls.CertificateVerificationError
+		alert            tls.AlertError
+		recordHeader     tls.RecordHeaderError
+	)
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostname), errors.As(err, &invalid),
+		errors.As(err, &verification), errors.As(err, &alert), errors.As(err, &recordHeader):
+		return true
+	}
+	// Some TLS failures (e.g. a missing client certificate) only surface as a remote alert message
+	return strings.Contains(err.Error(), "tls: ") || strings.Contains(err.Error(), "x509: ")
+}
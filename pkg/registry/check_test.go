@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRegistryServer starts an in-memory registry accepting anonymous pushes and returns its host:port
+func newRegistryServer(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// newStatusServer starts a registry answering /v2/ with 200 and every other request with status and code
+func newStatusServer(t *testing.T, status int, code string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []map[string]string{{"code": code, "message": "probe rejected"}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestRegistryLogin_Classified(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	// A port nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := l.Addr().String()
+	l.Close()
+
+	notRegistry := httptest.NewServer(http.NotFoundHandler())
+	defer notRegistry.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		insecure bool
+		want     error
+	}{
+		{"Unauthorized", newStatusServer(t, http.StatusUnauthorized, "UNAUTHORIZED"), false, ErrAuth},
+		{"Forbidden", newStatusServer(t, http.StatusForbidden, "DENIED"), false, ErrPermission},
+		{"Untrusted certificate", strings.TrimPrefix(tlsServer.URL, "https://"), false, ErrTLS},
+		{"Connection refused", closedAddr, false, ErrNetwork},
+		{"Not a registry", strings.TrimPrefix(notRegistry.URL, "http://"), false, ErrNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			r := New("", tt.url, "", tt.insecure)
+			err := r.RegistryLogin()
+			assert.True(t, errors.Is(err, tt.want), "got %v, want %v", err, tt.want)
+		})
+	}
+}
+
+func TestRegistryLogin_TLSInsecure(t *testing.T) {
+	setupTest(t)
+
+	server := httptest.NewTLSServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	r := New("", strings.TrimPrefix(server.URL, "https://"), "", true)
+	assert.NoError(t, r.RegistryLogin())
+}
+
+func TestRegistryLogin_ProbeRepository(t *testing.T) {
+	setupTest(t)
+
+	var probed string
+	remoteCheckPushPermission = func(ref name.Reference, kc authn.Keychain, t http.RoundTripper) error {
+		probed = ref.Context().String()
+		return nil
+	}
+
+	host := newRegistryServer(t)
+	r := New("", host+"/edge", "", false)
+	assert.NoError(t, r.RegistryLogin())
+	assert.Equal(t, host+"/edge/"+ProbeRepository, probed)
+}
@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// progressKey holds the byte counter of a write in its context
+type progressKey struct{}
+
+// countingTransport reports the bytes of the request bodies to the counter of the request context, so the
+// writes sharing the pusher and its cached registry tokens still report their own progress
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	count, ok := req.Context().Value(progressKey{}).(func(n int64))
+	if !ok || req.Body == nil || req.Body == http.NoBody {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrip must not modify the request, the body is counted on a shallow copy
+	counted := req.Clone(req.Context())
+	counted.Body = &countingBody{ReadCloser: req.Body, count: count}
+	return t.base.RoundTrip(counted)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	count func(n int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.count(int64(n))
+	}
+	return n, err
+}
+
+// withProgress returns a context reporting the bytes sent by the requests made with it to count
+func withProgress(ctx context.Context, count func(n int64)) context.Context {
+	return context.WithValue(ctx, progressKey{}, count)
+}
@@ -2,31 +2,42 @@ package registry
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"github.com/alknopfler/seactl/pkg/transport"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 )
 
 type Registry struct {
-	RegistryAuthFile string
-	RegistryURL      string
-	RegistryCACert   string
-	RegistryInsecure bool
+	RegistryAuthFile   string
+	RegistryURL        string
+	RegistryCACert     string
+	RegistryInsecure   bool
+	RegistryClientCert string // client certificate for registries requiring mutual TLS, with RegistryClientKey
+	RegistryClientKey  string
+	Rewrites           []Rewrite // rewrite rules of the repository paths in the registry, see TargetRepository
+
+	// The transport, credentials and token exchanges are shared by every push of a run
+	remoteOnce sync.Once
+	remoteOpts []remote.Option
+	remoteErr  error
+	rt         http.RoundTripper
+	auth       authn.Authenticator
+
+	loginOnce sync.Once
+	loginErr  error
 }
 
-var (
-	execCommand   = exec.Command
-	remoteCatalog = remote.Catalog
-)
+var execCommand = exec.Command
 
 func New(registryAuthFile, registryURL, registryCACert string, insecure bool) *Registry {
 	return &Registry{
@@ -53,68 +64,122 @@ func (r *Registry) RegistryHelmLogin() error {
 	} else if r.RegistryCACert != "" {
 		args = append(args, "--ca-file", r.RegistryCACert)
 	}
+	if r.RegistryClientCert != "" && r.RegistryClientKey != "" {
+		args = append(args, "--cert-file", r.RegistryClientCert, "--key-file", r.RegistryClientKey)
+	}
 	cmd := execCommand("helm", args...)
+	cmd.Env = transport.Environ(cmd.Env)
 	err = cmd.Run()
 
 	if err != nil {
-		log.Printf("failed to login to the registry: %s", err)
+		slog.Error("helm registry login failed", "registry", r.RegistryURL, "error", err)
 		return err
 	}
 	return nil
 }
 
+// RegistryLogin checks the credentials against the registry, only once per run: the later calls return
+// the result of the first one
 func (r *Registry) RegistryLogin() error {
-	ctx := context.Background()
-	tlsConfig := &tls.Config{}
+	r.loginOnce.Do(func() {
+		r.loginErr = r.login()
+	})
+	return r.loginErr
+}
 
-	if r.RegistryInsecure {
-		tlsConfig.InsecureSkipVerify = true
-	} else if r.RegistryCACert != "" {
-		// Load CA certificate
-		caCert, err := os.ReadFile(r.RegistryCACert)
-		if err != nil {
-			return err
-		}
+// login pings the /v2/ endpoint and probes the push permission on a scratch repository, _catalog is not
+// used as many registries disable it or restrict it to admins
+func (r *Registry) login() error {
+	if _, err := r.RemoteOptions(); err != nil {
+		return err
+	}
 
-		// Create a CA certificate pool
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-		tlsConfig.RootCAs = caCertPool
+	repo, err := name.NewRepository(r.RegistryURL+"/"+ProbeRepository, name.WeakValidation)
+	if err != nil {
+		return fmt.Errorf("invalid registry %q: %v", r.RegistryURL, err)
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig: tlsConfig,
+	if err := ping(context.Background(), repo.Registry, r.rt); err != nil {
+		return fmt.Errorf("registry %q: %w", r.RegistryURL, err)
+	}
+	if err := r.probePush(repo); err != nil {
+		return fmt.Errorf("registry %q: %w", r.RegistryURL, err)
 	}
 
-	// Create an HTTP client with the custom transport
-	client := &http.Client{Transport: transport}
+	slog.Info("registry check passed", "registry", r.RegistryURL)
+	return nil
+}
 
-	authFileInfo, err := r.GetUserFromAuthFile()
-	if err != nil {
-		return fmt.Errorf("failed to get user credentials from authFile: %w", err)
+// TLS returns the TLS settings of the registry: CA bundle, client certificate and insecure flag
+func (r *Registry) TLS() transport.TLS {
+	return transport.TLS{
+		CACert:     r.RegistryCACert,
+		ClientCert: r.RegistryClientCert,
+		ClientKey:  r.RegistryClientKey,
+		Insecure:   r.RegistryInsecure,
 	}
+}
 
-	auth := &authn.Basic{
-		Username: authFileInfo[0],
-		Password: authFileInfo[1],
-	}
+// Transport returns the HTTP transport to talk to the registry: proxy settings plus the registry TLS settings
+func (r *Registry) Transport() (*http.Transport, error) {
+	return transport.New(r.TLS())
+}
 
-	// Remote options with custom HTTP client and authenticator
-	remoteOpts := remote.WithTransport(client.Transport)
-	authOpts := remote.WithAuth(auth)
+// RemoteOptions returns the go-containerregistry options to talk to the registry: TLS and proxy settings
+// and the credentials from the auth file (anonymous when no auth file is configured). They are created
+// once and shared, so every push reuses the same connections and registry tokens.
+func (r *Registry) RemoteOptions() ([]remote.Option, error) {
+	r.remoteOnce.Do(func() {
+		r.remoteOpts, r.remoteErr = r.newRemoteOptions()
+	})
+	return r.remoteOpts, r.remoteErr
+}
 
-	ref, err := name.NewRegistry(r.RegistryURL)
+// ProgressOptions returns the shared remote options of a single write reporting the bytes it sends to
+// count. The writes keep sharing the pusher, so the connections and the registry tokens of every repository.
+func (r *Registry) ProgressOptions(count func(n int64)) ([]remote.Option, error) {
+	opts, err := r.RemoteOptions()
 	if err != nil {
-		return fmt.Errorf("invalid registry %q: %v", r.RegistryURL, err)
+		return nil, err
 	}
+	return append(slices.Clone(opts), remote.WithContext(withProgress(context.Background(), count))), nil
+}
 
-	_, err = remoteCatalog(ctx, ref, remoteOpts, authOpts)
+func (r *Registry) newRemoteOptions() ([]remote.Option, error) {
+	t, err := r.Transport()
 	if err != nil {
-		return fmt.Errorf("error pinging registry %q: %v", r.RegistryURL, err)
+		return nil, err
 	}
 
-	log.Printf("successfully authenticated to registry %q", r.RegistryURL)
-	return nil
+	var auth authn.Authenticator = authn.Anonymous
+	if r.RegistryAuthFile != "" {
+		authFileInfo, err := r.GetUserFromAuthFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user credentials from authFile: %w", err)
+		}
+		auth = &authn.Basic{
+			Username: authFileInfo[0],
+			Password: authFileInfo[1],
+		}
+	}
+
+	// The bytes sent are counted on the shared transport, see ProgressOptions
+	r.rt, r.auth = &countingTransport{base: t}, auth
+	opts := []remote.Option{
+		remote.WithTransport(r.rt),
+		remote.WithAuth(auth),
+	}
+
+	// The pusher and puller cache the authenticated transport of every repository
+	pusher, err := remote.NewPusher(opts...)
+	if err != nil {
+		return nil, err
+	}
+	puller, err := remote.NewPuller(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, remote.Reuse(pusher), remote.Reuse(puller)), nil
 }
 
 func (r *Registry) GetUserFromAuthFile() ([]string, error) {
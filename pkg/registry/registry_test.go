@@ -1,15 +1,16 @@
 package registry
 
 import (
-	"context"
 	"errors"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,13 +24,13 @@ func writeTempFile(t *testing.T, content string) string {
 }
 
 var (
-	origExecCommand   = execCommand
-	origRemoteCatalog = remoteCatalog
+	origExecCommand               = execCommand
+	origRemoteCheckPushPermission = remoteCheckPushPermission
 )
 
 func setupTest(t *testing.T) {
 	execCommand = origExecCommand
-	remoteCatalog = origRemoteCatalog
+	remoteCheckPushPermission = origRemoteCheckPushPermission
 }
 
 func TestNew(t *testing.T) {
@@ -97,6 +98,23 @@ func TestRegistryHelmLogin_WithCredentials(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestRegistryHelmLogin_WithClientCert(t *testing.T) {
+	setupTest(t)
+
+	authFile := writeTempFile(t, "dXNlcg==:cGFzcw==")
+	r := New(authFile, "my-registry.io", "", false)
+	r.RegistryClientCert = "client.crt"
+	r.RegistryClientKey = "client.key"
+
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		assert.Contains(t, strings.Join(args, " "), "--cert-file client.crt --key-file client.key")
+		return exec.Command("echo")
+	}
+
+	err := r.RegistryHelmLogin()
+	assert.NoError(t, err)
+}
+
 func TestRegistryHelmLogin_FailExec(t *testing.T) {
 	setupTest(t)
 
@@ -133,28 +151,82 @@ func TestRegistryLogin_Success(t *testing.T) {
 	setupTest(t)
 
 	authFile := writeTempFile(t, "dXNlcg==:cGFzc3dvcmQ=")
-	r := New(authFile, "my-registry.io", "", true)
-
-	// Mock  remote.Catalog
-	remoteCatalog = func(ctx context.Context, reg name.Registry, opts ...remote.Option) ([]string, error) {
-		return []string{"repo1", "repo2"}, nil
-	}
+	server := newRegistryServer(t)
+	r := New(authFile, server, "", true)
 
 	err := r.RegistryLogin()
 	assert.NoError(t, err)
 }
 
-func TestRegistryLogin_FailCatalog(t *testing.T) {
+func TestRegistryLogin_FailProbe(t *testing.T) {
 	setupTest(t)
 
 	authFile := writeTempFile(t, "dXNlcg==:cGFzc3dvcmQ=")
-	r := New(authFile, "my-registry.io", "", true)
+	server := newRegistryServer(t)
+	r := New(authFile, server, "", true)
 
-	// Mock  remote.Catalog
-	remoteCatalog = func(ctx context.Context, reg name.Registry, opts ...remote.Option) ([]string, error) {
-		return nil, errors.New("fake error")
+	// Mock the push permission probe
+	remoteCheckPushPermission = func(ref name.Reference, kc authn.Keychain, t http.RoundTripper) error {
+		return errors.New("fake error")
 	}
 
 	err := r.RegistryLogin()
 	assert.Error(t, err)
 }
+
+func TestRemoteOptions_Anonymous(t *testing.T) {
+	setupTest(t)
+
+	r := New("", "my-registry.io", "", false)
+	opts, err := r.RemoteOptions()
+	require.NoError(t, err)
+	assert.NotEmpty(t, opts)
+}
+
+func TestRemoteOptions_Shared(t *testing.T) {
+	setupTest(t)
+
+	r := New("", "my-registry.io", "", false)
+	first, err := r.RemoteOptions()
+	require.NoError(t, err)
+	second, err := r.RemoteOptions()
+	require.NoError(t, err)
+
+	// Same options, so the same transport and the same cached tokens
+	require.NotEmpty(t, first)
+	assert.Equal(t, &first[0], &second[0])
+}
+
+func TestRegistryLogin_Once(t *testing.T) {
+	setupTest(t)
+
+	authFile := writeTempFile(t, "dXNlcg==:cGFzc3dvcmQ=")
+	r := New(authFile, newRegistryServer(t), "", true)
+
+	calls := 0
+	remoteCheckPushPermission = func(ref name.Reference, kc authn.Keychain, t http.RoundTripper) error {
+		calls++
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.RegistryLogin())
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestRemoteOptions_InvalidCACert(t *testing.T) {
+	setupTest(t)
+
+	r := New("", "my-registry.io", "missing-ca.crt", false)
+	_, err := r.RemoteOptions()
+	assert.Error(t, err)
+}
+
+func TestRemoteOptions_InvalidAuthFile(t *testing.T) {
+	setupTest(t)
+
+	r := New("not-exists.json", "my-registry.io", "", false)
+	_, err := r.RemoteOptions()
+	assert.Error(t, err)
+}
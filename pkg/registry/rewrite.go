@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// dockerHub is the registry name the Docker Hub images are written with, go-containerregistry uses index.docker.io
+const dockerHub = "docker.io"
+
+// Rewrite maps the source repositories under From (registry and path prefix, e.g. registry.suse.com/edge)
+// to the repositories under To in the target registry (a path, e.g. mirror/edge, empty to drop the prefix)
+type Rewrite struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// ParseRewrite parses a FROM=TO rewrite rule
+func ParseRewrite(rule string) (Rewrite, error) {
+	from, to, ok := strings.Cut(rule, "=")
+	rw := Rewrite{From: from, To: to}
+	if !ok {
+		return rw, fmt.Errorf("invalid rewrite rule %q, expected FROM=TO", rule)
+	}
+	return rw, rw.Validate()
+}
+
+// Validate returns an error if the rule has no source prefix
+func (rw Rewrite) Validate() error {
+	if strings.Trim(rw.From, "/") == "" {
+		return fmt.Errorf("invalid rewrite rule %q=%q, the source prefix is empty", rw.From, rw.To)
+	}
+	return nil
+}
+
+// String returns the rule as FROM=TO
+func (rw Rewrite) String() string {
+	return rw.From + "=" + rw.To
+}
+
+// TargetRepository returns the repository path of src in the registry: mapped by the first rewrite rule
+// matching it, the source repository path otherwise
+func (r *Registry) TargetRepository(src name.Repository) string {
+	if repo, ok := r.RewriteRepository(src); ok {
+		return repo
+	}
+	return src.RepositoryStr()
+}
+
+// RewriteRepository returns the repository path src is mapped to by the first rewrite rule matching it,
+// false when no rule matches
+func (r *Registry) RewriteRepository(src name.Repository) (string, bool) {
+	registryName := src.RegistryStr()
+	if registryName == name.DefaultRegistry {
+		registryName = dockerHub
+	}
+	full := registryName + "/" + src.RepositoryStr()
+
+	for _, rw := range r.Rewrites {
+		from := strings.Trim(rw.From, "/")
+		to := strings.Trim(rw.To, "/")
+		var rest string
+		switch {
+		case full == from:
+		case strings.HasPrefix(full, from+"/"):
+			rest = strings.TrimPrefix(full, from+"/")
+		default:
+			continue
+		}
+		if to == "" {
+			return rest, true
+		}
+		if rest == "" {
+			return to, true
+		}
+		return to + "/" + rest, true
+	}
+	return "", false
+}
@@ -0,0 +1,46 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRewrite(t *testing.T) {
+	rw, err := ParseRewrite("registry.suse.com/edge=mirror/edge")
+	require.NoError(t, err)
+	assert.Equal(t, Rewrite{From: "registry.suse.com/edge", To: "mirror/edge"}, rw)
+	assert.Equal(t, "registry.suse.com/edge=mirror/edge", rw.String())
+
+	_, err = ParseRewrite("registry.suse.com/edge")
+	assert.Error(t, err)
+	_, err = ParseRewrite("=mirror")
+	assert.Error(t, err)
+}
+
+func TestTargetRepository(t *testing.T) {
+	r := New("", "registry.local:5000", "", false)
+	r.Rewrites = []Rewrite{
+		{From: "registry.suse.com/edge/", To: "mirror/edge"},
+		{From: "docker.io/library", To: ""},
+		{From: "registry.suse.com", To: "suse"},
+	}
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"registry.suse.com/edge/3.1/kubevirt-chart:0.4.0", "mirror/edge/3.1/kubevirt-chart"},
+		{"registry.suse.com/edgex/foo:1", "suse/edgex/foo"},
+		{"nginx:1.27", "nginx"},
+		{"docker.io/rancher/hardened-etcd:v3.5", "rancher/hardened-etcd"},
+		{"quay.io/jetstack/cert-manager-controller:v1.15", "jetstack/cert-manager-controller"},
+	}
+	for _, tt := range tests {
+		ref, err := name.ParseReference(tt.image)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, r.TargetRepository(ref.Context()), tt.image)
+	}
+}
@@ -0,0 +1,246 @@
+package releases
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/alknopfler/seactl/pkg/semver"
+	"github.com/alknopfler/seactl/pkg/transport"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ggcrtransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// FirstStream is the first MAJOR.MINOR stream probed when none is given
+const FirstStream = "3.0"
+
+// maxMajor bounds the discovery of the streams
+const maxMajor = 99
+
+// Release is a release manifest version available in a release-manifest repository
+type Release struct {
+	Version    semver.Version
+	Repository string
+	Latest     bool // the highest release, or the highest pre-release when there is no release
+
+	// Details, only filled when asked to
+	RKE2   string
+	K3s    string
+	Images int
+	Charts int
+}
+
+// Options are the settings of a releases listing
+type Options struct {
+	Mode    string   // factory, production or a custom OCI release source, see config.LookupReleaseSource
+	Streams []string // MAJOR.MINOR streams of a streamed source (e.g. production), discovered from FirstStream when empty
+	Details bool     // read every release manifest for its RKE2/K3s versions and image and chart counts
+}
+
+var (
+	// listTags and readManifest are assignable for testing
+	listTags = func(repo name.Repository) ([]string, error) {
+		return remote.List(repo, remote.WithTransport(transport.Source()), remote.WithAuthFromKeychain(transport.SourceKeychain()))
+	}
+	readManifest = config.ReadAirgapManifest
+)
+
+// List returns the releases of the release-manifest repositories of the mode, the highest version first. The
+// tags which are not semantic versions (e.g. latest) are left out. Only the OCI release sources have tags to
+// list, the streamed ones (e.g. production) being listed per MAJOR.MINOR stream.
+func List(opts Options) ([]Release, error) {
+	source, err := config.LookupReleaseSource(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+	oci, ok := source.(*config.OCISource)
+	if !ok {
+		return nil, fmt.Errorf("release mode %q is not an OCI release source, only the release images tags can be listed", opts.Mode)
+	}
+
+	var repos []string
+	switch {
+	case !oci.Streamed():
+		repo, err := oci.Repository("")
+		if err != nil {
+			return nil, err
+		}
+		repos = []string{repo}
+	case len(opts.Streams) > 0:
+		for _, stream := range opts.Streams {
+			repo, err := oci.Repository(stream)
+			if err != nil {
+				return nil, err
+			}
+			repos = append(repos, repo)
+		}
+	default:
+		if repos, err = discoverStreams(oci); err != nil {
+			return nil, err
+		}
+	}
+
+	var releases []Release
+	for _, repo := range repos {
+		found, err := listRepository(repo)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, found...)
+	}
+	sort.SliceStable(releases, func(i, j int) bool { return releases[i].Version.Compare(releases[j].Version) > 0 })
+	markLatest(releases)
+
+	if opts.Details {
+		for i := range releases {
+			if err := addDetails(&releases[i], opts.Mode); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return releases, nil
+}
+
+// discoverStreams returns the repositories of the streams of source from FirstStream on, the minors of a
+// major until the first missing one and the majors until the first without a .0 stream
+func discoverStreams(source *config.OCISource) ([]string, error) {
+	first, err := semver.Parse(FirstStream + ".0")
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []string
+	for major := first.Major; major <= maxMajor; major++ {
+		minor := 0
+		if major == first.Major {
+			minor = first.Minor
+		}
+		start := minor
+		for ; ; minor++ {
+			repo, err := source.Repository(fmt.Sprintf("%d.%d", major, minor))
+			if err != nil {
+				return nil, err
+			}
+			exists, err := repositoryExists(repo)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				break
+			}
+			repos = append(repos, repo)
+		}
+		if minor == start {
+			break
+		}
+	}
+	slog.Debug("release streams discovered", "repositories", repos)
+	return repos, nil
+}
+
+func repositoryExists(repo string) (bool, error) {
+	_, err := tags(repo)
+	if err == nil {
+		return true, nil
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// isNotFound reports whether err tells the repository does not exist: a 404 or a NAME_UNKNOWN error. The
+// authorization errors are not, missing or wrong credentials must not end the discovery silently.
+func isNotFound(err error) bool {
+	var terr *ggcrtransport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	for _, d := range terr.Errors {
+		if d.Code == ggcrtransport.NameUnknownErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+func tags(repo string) ([]string, error) {
+	r, err := name.NewRepository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository %q: %v", repo, err)
+	}
+	return listTags(r)
+}
+
+func listRepository(repo string) ([]Release, error) {
+	list, err := tags(repo)
+	if err != nil {
+		return nil, fmt.Errorf("listing the tags of %s: %w", repo, err)
+	}
+	var releases []Release
+	for _, tag := range list {
+		v, err := semver.Parse(tag)
+		if err != nil {
+			slog.Debug("tag skipped, not a semantic version", "repository", repo, "tag", tag)
+			continue
+		}
+		releases = append(releases, Release{Version: v, Repository: repo})
+	}
+	return releases, nil
+}
+
+// markLatest marks the first release of the sorted releases, or the first pre-release when there is none
+func markLatest(releases []Release) {
+	for i := range releases {
+		if !releases[i].Version.IsPrerelease() {
+			releases[i].Latest = true
+			return
+		}
+	}
+	if len(releases) > 0 {
+		releases[0].Latest = true
+	}
+}
+
+func addDetails(r *Release, mode string) error {
+	releaseManifest, imagesManifest, err := readManifest(r.Version.String(), mode)
+	if err != nil {
+		return fmt.Errorf("reading the release manifest %s: %w", r.Version, err)
+	}
+	r.RKE2 = releaseManifest.Spec.Components.Kubernetes.Rke2.Version
+	r.K3s = releaseManifest.Spec.Components.Kubernetes.K3S.Version
+	r.Images = len(imagesManifest.Images)
+	r.Charts = len(releaseManifest.Spec.Components.Workloads.Helm)
+	return nil
+}
+
+// Print writes the releases as a table, with the details columns when asked to
+func Print(w io.Writer, releases []Release, details bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if details {
+		fmt.Fprintln(tw, "VERSION\tLATEST\tRKE2\tK3S\tIMAGES\tCHARTS")
+	} else {
+		fmt.Fprintln(tw, "VERSION\tLATEST")
+	}
+	for _, r := range releases {
+		latest := ""
+		if r.Latest {
+			latest = "*"
+		}
+		if details {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", r.Version, latest, r.RKE2, r.K3s, r.Images, r.Charts)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", r.Version, latest)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,178 @@
+package releases
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/config"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrtransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry answers the tags listing of the repositories in tags, a 404 for the other ones
+func fakeRegistry(t *testing.T, tags map[string][]string) *[]string {
+	t.Helper()
+	var listed []string
+	orig := listTags
+	t.Cleanup(func() { listTags = orig })
+	listTags = func(repo name.Repository) ([]string, error) {
+		listed = append(listed, repo.String())
+		if list, ok := tags[repo.String()]; ok {
+			return list, nil
+		}
+		return nil, &ggcrtransport.Error{StatusCode: http.StatusNotFound}
+	}
+	return &listed
+}
+
+func versions(releases []Release) []string {
+	var got []string
+	for _, r := range releases {
+		v := r.Version.String()
+		if r.Latest {
+			v += "*"
+		}
+		got = append(got, v)
+	}
+	return got
+}
+
+func TestList_Factory(t *testing.T) {
+	fakeRegistry(t, map[string][]string{
+		"registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest": {
+			"3.1.0", "latest", "3.2.0-rc1", "3.10.0-rc2", "3.1.1", "3.2.0",
+		},
+	})
+
+	releases, err := List(Options{Mode: "factory"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3.10.0-rc2", "3.2.0*", "3.2.0-rc1", "3.1.1", "3.1.0"}, versions(releases))
+}
+
+func TestList_OnlyPrereleases(t *testing.T) {
+	fakeRegistry(t, map[string][]string{
+		"registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest": {"3.2.0-rc1", "3.2.0-rc2"},
+	})
+
+	releases, err := List(Options{Mode: "factory"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3.2.0-rc2*", "3.2.0-rc1"}, versions(releases))
+}
+
+func TestList_ProductionDiscovery(t *testing.T) {
+	listed := fakeRegistry(t, map[string][]string{
+		"registry.suse.com/edge/3.0/release-manifest": {"3.0.0", "3.0.1"},
+		"registry.suse.com/edge/3.1/release-manifest": {"3.1.0"},
+		"registry.suse.com/edge/4.0/release-manifest": {"4.0.0"},
+		"registry.suse.com/edge/4.1/release-manifest": {"4.1.0"},
+	})
+
+	releases, err := List(Options{Mode: "production"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4.1.0*", "4.0.0", "3.1.0", "3.0.1", "3.0.0"}, versions(releases))
+	assert.Contains(t, *listed, "registry.suse.com/edge/5.0/release-manifest")
+	assert.NotContains(t, *listed, "registry.suse.com/edge/6.0/release-manifest")
+}
+
+func TestList_ProductionStreams(t *testing.T) {
+	fakeRegistry(t, map[string][]string{
+		"registry.suse.com/edge/3.0/release-manifest": {"3.0.0"},
+		"registry.suse.com/edge/3.1/release-manifest": {"3.1.0", "3.1.1"},
+	})
+
+	releases, err := List(Options{Mode: "production", Streams: []string{"3.1"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3.1.1*", "3.1.0"}, versions(releases))
+
+	_, err = List(Options{Mode: "production", Streams: []string{"3.2"}})
+	assert.ErrorContains(t, err, "registry.suse.com/edge/3.2/release-manifest")
+}
+
+func TestList_Errors(t *testing.T) {
+	_, err := List(Options{Mode: "staging"})
+	assert.Error(t, err)
+
+	orig := listTags
+	defer func() { listTags = orig }()
+	listTags = func(repo name.Repository) ([]string, error) { return nil, errors.New("connection refused") }
+	_, err = List(Options{Mode: "production"})
+	assert.ErrorContains(t, err, "connection refused")
+}
+
+func TestList_AuthErrors(t *testing.T) {
+	orig := listTags
+	defer func() { listTags = orig }()
+
+	// an authorization error is not a missing stream
+	listTags = func(repo name.Repository) ([]string, error) {
+		if repo.String() == "registry.suse.com/edge/3.0/release-manifest" {
+			return []string{"3.0.0"}, nil
+		}
+		return nil, &ggcrtransport.Error{StatusCode: http.StatusUnauthorized}
+	}
+	_, err := List(Options{Mode: "production"})
+	assert.Error(t, err)
+
+	// a registry answering NAME_UNKNOWN with another status
+	listTags = func(repo name.Repository) ([]string, error) {
+		if repo.String() == "registry.suse.com/edge/3.0/release-manifest" {
+			return []string{"3.0.0"}, nil
+		}
+		return nil, &ggcrtransport.Error{
+			StatusCode: http.StatusForbidden,
+			Errors:     []ggcrtransport.Diagnostic{{Code: ggcrtransport.NameUnknownErrorCode}},
+		}
+	}
+	releases, err := List(Options{Mode: "production"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3.0.0*"}, versions(releases))
+}
+
+func TestList_Details(t *testing.T) {
+	fakeRegistry(t, map[string][]string{
+		"registry.opensuse.org/isv/suse/edge/factory/test_manifest_images/release-manifest": {"3.1.0"},
+	})
+	orig := readManifest
+	defer func() { readManifest = orig }()
+	readManifest = func(version, mode string) (*config.ReleaseManifest, *config.ImagesManifest, error) {
+		m := &config.ReleaseManifest{}
+		m.Spec.Components.Kubernetes.Rke2.Version = "v1.30.3+rke2r1"
+		m.Spec.Components.Kubernetes.K3S.Version = "v1.30.3+k3s1"
+		m.Spec.Components.Workloads.Helm = []config.HelmWorkload{{ReleaseName: "rancher"}}
+		return m, &config.ImagesManifest{Images: []config.Image{{Name: "a"}, {Name: "b"}}}, nil
+	}
+
+	releases, err := List(Options{Mode: "factory", Details: true})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, Print(&out, releases, true))
+	assert.Equal(t, "VERSION  LATEST  RKE2            K3S           IMAGES  CHARTS\n"+
+		"3.1.0    *       v1.30.3+rke2r1  v1.30.3+k3s1  2       1\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Print(&out, releases, false))
+	assert.Equal(t, "VERSION  LATEST\n3.1.0    *\n", out.String())
+}
+
+func TestList_CustomSource(t *testing.T) {
+	require.NoError(t, config.SetReleaseSources([]string{
+		"staging=oci://registry.local/edge/{{.Stream}}/release-manifest:{{.Version}}",
+		"local=dir:///srv/edge-manifests",
+	}))
+	defer config.SetReleaseSources(nil)
+	fakeRegistry(t, map[string][]string{
+		"registry.local/edge/3.2/release-manifest": {"3.2.0-rc1", "3.2.0"},
+	})
+
+	releases, err := List(Options{Mode: "staging", Streams: []string{"3.2"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3.2.0*", "3.2.0-rc1"}, versions(releases))
+
+	_, err = List(Options{Mode: "local"})
+	assert.ErrorContains(t, err, "not an OCI release source")
+}
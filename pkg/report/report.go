@@ -0,0 +1,244 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Report formats
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// FileName is the name of the report written to the output directory, followed by the format extension
+const FileName = "seactl-report"
+
+// Statuses of the report entries
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+	StatusDryRun  = "dry-run"
+	// StatusFiltered marks the images and charts left out by the include/exclude filters
+	StatusFiltered = "filtered"
+)
+
+// Report records what a generate run mirrored, it is safe for concurrent use
+type Report struct {
+	mu sync.Mutex
+
+	ReleaseVersion string   `json:"releaseVersion" yaml:"releaseVersion"`
+	ReleaseMode    string   `json:"releaseMode" yaml:"releaseMode"`
+	Registry       string   `json:"registry,omitempty" yaml:"registry,omitempty"`
+	DryRun         bool     `json:"dryRun" yaml:"dryRun"`
+	StartedAt      string   `json:"startedAt" yaml:"startedAt"`
+	FinishedAt     string   `json:"finishedAt,omitempty" yaml:"finishedAt,omitempty"`
+	Duration       float64  `json:"durationSeconds" yaml:"durationSeconds"`
+	Status         string   `json:"status" yaml:"status"`
+	Totals         Totals   `json:"totals" yaml:"totals"`
+	Images         []Image  `json:"images" yaml:"images"`
+	Charts         []Chart  `json:"charts" yaml:"charts"`
+	Files          []File   `json:"files" yaml:"files"`
+	Errors         []string `json:"errors" yaml:"errors"`
+
+	started time.Time
+}
+
+// Image is a mirrored container image
+type Image struct {
+	Source   string  `json:"source" yaml:"source"`
+	Target   string  `json:"target,omitempty" yaml:"target,omitempty"`
+	Digest   string  `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Size     int64   `json:"size" yaml:"size"` // manifest, config and compressed layers, in bytes
+	Status   string  `json:"status" yaml:"status"`
+	Reason   string  `json:"reason,omitempty" yaml:"reason,omitempty"` // why the image was skipped or filtered out
+	Duration float64 `json:"durationSeconds" yaml:"durationSeconds"`
+	Error    string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Chart is a mirrored helm chart
+type Chart struct {
+	Name       string  `json:"name" yaml:"name"`
+	Chart      string  `json:"chart" yaml:"chart"`
+	Version    string  `json:"version" yaml:"version"`
+	Repository string  `json:"repository,omitempty" yaml:"repository,omitempty"`
+	Target     string  `json:"target,omitempty" yaml:"target,omitempty"`
+	Status     string  `json:"status" yaml:"status"`
+	Reason     string  `json:"reason,omitempty" yaml:"reason,omitempty"` // why the chart was skipped or filtered out
+	Duration   float64 `json:"durationSeconds" yaml:"durationSeconds"`
+	Error      string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// File is a downloaded Kubernetes distribution file (RKE2 or K3s)
+type File struct {
+	Component string `json:"component" yaml:"component"`
+	Name      string `json:"name" yaml:"name"`
+	Path      string `json:"path" yaml:"path"`
+	SHA256    string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Size      int64  `json:"size" yaml:"size"`
+	Status    string `json:"status" yaml:"status"`
+}
+
+// Totals sums up the entries of the report
+type Totals struct {
+	Images         int   `json:"images" yaml:"images"`
+	ImagesFailed   int   `json:"imagesFailed" yaml:"imagesFailed"`
+	ImagesFiltered int   `json:"imagesFiltered" yaml:"imagesFiltered"`
+	Charts         int   `json:"charts" yaml:"charts"`
+	ChartsFailed   int   `json:"chartsFailed" yaml:"chartsFailed"`
+	ChartsFiltered int   `json:"chartsFiltered" yaml:"chartsFiltered"`
+	Files          int   `json:"files" yaml:"files"`
+	Bytes          int64 `json:"bytes" yaml:"bytes"`
+	Errors         int   `json:"errors" yaml:"errors"`
+}
+
+// now is assignable for testing
+var now = time.Now
+
+// New returns an empty report for a run started now
+func New(releaseVersion, releaseMode, registry string, dryRun bool) *Report {
+	started := now()
+	return &Report{
+		ReleaseVersion: releaseVersion,
+		ReleaseMode:    releaseMode,
+		Registry:       registry,
+		DryRun:         dryRun,
+		StartedAt:      started.UTC().Format(time.RFC3339),
+		Images:         []Image{},
+		Charts:         []Chart{},
+		Files:          []File{},
+		Errors:         []string{},
+		started:        started,
+	}
+}
+
+// ValidateFormat returns an error if format is not FormatJSON or FormatYAML
+func ValidateFormat(format string) error {
+	if format != FormatJSON && format != FormatYAML {
+		return fmt.Errorf("invalid report format %q, allowed: '%s' or '%s'", format, FormatJSON, FormatYAML)
+	}
+	return nil
+}
+
+// Since returns the seconds elapsed since start, the unit of every duration of the report
+func Since(start time.Time) float64 {
+	return now().Sub(start).Seconds()
+}
+
+// AddImage records an image
+func (r *Report) AddImage(img Image) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Images = append(r.Images, img)
+}
+
+// AddChart records a chart
+func (r *Report) AddChart(chart Chart) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Charts = append(r.Charts, chart)
+}
+
+// AddFile records a downloaded file
+func (r *Report) AddFile(file File) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Files = append(r.Files, file)
+}
+
+// AddError records an error of the run, the failed image or chart entries carry their own error too
+func (r *Report) AddError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// Finish stamps the end of the run and computes the totals and the overall status
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	finished := now()
+	r.FinishedAt = finished.UTC().Format(time.RFC3339)
+	r.Duration = finished.Sub(r.started).Seconds()
+
+	t := Totals{Images: len(r.Images), Charts: len(r.Charts), Files: len(r.Files), Errors: len(r.Errors)}
+	for _, img := range r.Images {
+		switch img.Status {
+		case StatusFailed:
+			t.ImagesFailed++
+		case StatusFiltered:
+			t.ImagesFiltered++
+		}
+		t.Bytes += img.Size
+	}
+	for _, chart := range r.Charts {
+		switch chart.Status {
+		case StatusFailed:
+			t.ChartsFailed++
+		case StatusFiltered:
+			t.ChartsFiltered++
+		}
+	}
+	for _, file := range r.Files {
+		t.Bytes += file.Size
+	}
+	r.Totals = t
+
+	r.Status = StatusOK
+	if len(r.Errors) > 0 {
+		r.Status = StatusFailed
+	}
+}
+
+// Encode writes the report to w in the given format
+func (r *Report) Encode(w io.Writer, format string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case FormatYAML:
+		data, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return ValidateFormat(format)
+	}
+}
+
+// Write writes the report to dir/FileName.<format> and returns its path
+func (r *Report) Write(dir, format string) (string, error) {
+	if err := ValidateFormat(format); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("creating report directory: %v", err)
+	}
+
+	path := filepath.Join(dir, FileName+"."+format)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("creating report file: %v", err)
+	}
+	defer f.Close()
+
+	if err := r.Encode(f, format); err != nil {
+		return "", fmt.Errorf("writing report: %v", err)
+	}
+	return path, nil
+}
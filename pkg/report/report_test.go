@@ -0,0 +1,100 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func fakeClock(t *testing.T, times ...time.Time) {
+	t.Cleanup(func() { now = time.Now })
+	now = func() time.Time {
+		current := times[0]
+		if len(times) > 1 {
+			times = times[1:]
+		}
+		return current
+	}
+}
+
+func TestReport_Finish(t *testing.T) {
+	start := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	fakeClock(t, start, start.Add(90*time.Second))
+
+	r := New("3.1.0", "production", "registry.local:5000", false)
+	r.AddImage(Image{Source: "docker.io/library/nginx:1.27", Size: 100, Status: StatusOK})
+	r.AddImage(Image{Source: "docker.io/library/redis:7", Size: 50, Status: StatusFailed, Error: "denied"})
+	r.AddChart(Chart{Name: "rancher", Status: StatusOK})
+	r.AddFile(File{Component: "rke2", Name: "rke2.linux-amd64.tar.gz", Size: 1000, Status: StatusOK})
+	r.AddError(errors.New("pushing image: denied"))
+	r.Finish()
+
+	assert.Equal(t, "2024-07-01T10:00:00Z", r.StartedAt)
+	assert.Equal(t, "2024-07-01T10:01:30Z", r.FinishedAt)
+	assert.Equal(t, 90.0, r.Duration)
+	assert.Equal(t, StatusFailed, r.Status)
+	assert.Equal(t, Totals{Images: 2, ImagesFailed: 1, Charts: 1, Files: 1, Bytes: 1150, Errors: 1}, r.Totals)
+}
+
+func TestReport_FinishOK(t *testing.T) {
+	r := New("3.1.0", "factory", "", true)
+	r.AddImage(Image{Source: "nginx", Status: StatusDryRun})
+	r.Finish()
+
+	assert.Equal(t, StatusOK, r.Status)
+	assert.Equal(t, 1, r.Totals.Images)
+	assert.Empty(t, r.Errors)
+}
+
+func TestReport_Write(t *testing.T) {
+	r := New("3.1.0", "factory", "registry.local:5000", false)
+	r.AddImage(Image{Source: "docker.io/library/nginx:1.27", Target: "registry.local:5000/library/nginx:1.27", Digest: "sha256:abc", Status: StatusOK})
+	r.Finish()
+
+	dir := filepath.Join(t.TempDir(), "output")
+	path, err := r.Write(dir, FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "seactl-report.json"), path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded Report
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "sha256:abc", decoded.Images[0].Digest)
+	assert.Equal(t, []Chart{}, decoded.Charts)
+
+	path, err = r.Write(dir, FormatYAML)
+	require.NoError(t, err)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	decoded = Report{}
+	require.NoError(t, yaml.Unmarshal(data, &decoded))
+	assert.Equal(t, "registry.local:5000/library/nginx:1.27", decoded.Images[0].Target)
+
+	_, err = r.Write(dir, "xml")
+	assert.Error(t, err)
+}
+
+func TestReport_Encode(t *testing.T) {
+	r := New("3.1.0", "factory", "", false)
+	r.Finish()
+
+	var out bytes.Buffer
+	require.NoError(t, r.Encode(&out, FormatYAML))
+	assert.Contains(t, out.String(), "releaseVersion: 3.1.0")
+	assert.Error(t, r.Encode(&out, "xml"))
+}
+
+func TestValidateFormat(t *testing.T) {
+	assert.NoError(t, ValidateFormat(FormatJSON))
+	assert.NoError(t, ValidateFormat(FormatYAML))
+	assert.Error(t, ValidateFormat("yml"))
+}
@@ -0,0 +1,186 @@
+package rke2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alknopfler/seactl/pkg/download"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// ArtifactType identifies the OCI artifacts holding an RKE2 release file
+	ArtifactType = "application/vnd.suse.edge.rke2.artifact.v1"
+	// ArtifactRepository is the repository path, under the registry URL, where the RKE2 files are pushed
+	ArtifactRepository = "rke2"
+
+	emptyConfigMediaType = "application/vnd.oci.empty.v1+json"
+	annotationTitle      = "org.opencontainers.image.title"
+)
+
+var (
+	remoteWriteLayer = remote.WriteLayer
+	remotePut        = remote.Put
+	remoteGet        = remote.Get
+	remoteLayer      = remote.Layer
+)
+
+// artifactManifest is an OCI 1.1 image manifest with artifactType, not supported by v1.Manifest yet
+type artifactManifest struct {
+	SchemaVersion int64             `json:"schemaVersion"`
+	MediaType     types.MediaType   `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        v1.Descriptor     `json:"config"`
+	Layers        []v1.Descriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type rawManifest []byte
+
+func (m rawManifest) RawManifest() ([]byte, error) { return m, nil }
+
+func (m rawManifest) MediaType() (types.MediaType, error) { return types.OCIManifestSchema1, nil }
+
+// fileLayer is a v1.Layer streaming its content from a file on disk, so the tarballs are never loaded in memory
+type fileLayer struct {
+	path      string
+	digest    v1.Hash
+	size      int64
+	mediaType types.MediaType
+}
+
+func newFileLayer(path string) (*fileLayer, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := download.FileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileLayer{
+		path:      path,
+		digest:    v1.Hash{Algorithm: "sha256", Hex: sum},
+		size:      fi.Size(),
+		mediaType: fileMediaType(path),
+	}, nil
+}
+
+func (l *fileLayer) Digest() (v1.Hash, error)             { return l.digest, nil }
+func (l *fileLayer) DiffID() (v1.Hash, error)             { return l.digest, nil }
+func (l *fileLayer) Compressed() (io.ReadCloser, error)   { return os.Open(l.path) }
+func (l *fileLayer) Uncompressed() (io.ReadCloser, error) { return os.Open(l.path) }
+func (l *fileLayer) Size() (int64, error)                 { return l.size, nil }
+func (l *fileLayer) MediaType() (types.MediaType, error)  { return l.mediaType, nil }
+
+func fileMediaType(path string) types.MediaType {
+	switch {
+	case strings.HasSuffix(path, ".zst"):
+		return "application/zstd"
+	case strings.HasSuffix(path, ".gz"):
+		return "application/gzip"
+	default:
+		return "text/plain"
+	}
+}
+
+// artifactTag converts the RKE2 version to a valid tag, v1.30.3+rke2r1 becomes v1.30.3-rke2r1
+func artifactTag(version string) string {
+	return strings.ReplaceAll(version, "+", "-")
+}
+
+// artifactReference returns the reference of the OCI artifact holding file for the given version
+func artifactReference(registryURL, file, version string) (name.Tag, error) {
+	return name.NewTag(fmt.Sprintf("%s/%s/%s:%s", registryURL, ArtifactRepository, file, artifactTag(version)), name.WeakValidation)
+}
+
+// pushArtifact pushes the file at path as a single-layer OCI artifact to ref
+func pushArtifact(ref name.Tag, path, version string, opts ...remote.Option) error {
+	layer, err := newFileLayer(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", path, err)
+	}
+	config := static.NewLayer([]byte("{}"), emptyConfigMediaType)
+
+	for _, l := range []v1.Layer{config, layer} {
+		if err := remoteWriteLayer(ref.Context(), l, opts...); err != nil {
+			return fmt.Errorf("pushing blob of %s: %v", path, err)
+		}
+	}
+
+	configDigest, _ := config.Digest()
+	manifest := artifactManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		ArtifactType:  ArtifactType,
+		Config:        v1.Descriptor{MediaType: emptyConfigMediaType, Digest: configDigest, Size: 2},
+		Layers: []v1.Descriptor{{
+			MediaType:   layer.mediaType,
+			Digest:      layer.digest,
+			Size:        layer.size,
+			Annotations: map[string]string{annotationTitle: filepath.Base(path)},
+		}},
+		Annotations: map[string]string{"io.cattle.rke2.version": version},
+	}
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := remotePut(ref, rawManifest(raw), opts...); err != nil {
+		return fmt.Errorf("pushing manifest of %s: %v", path, err)
+	}
+	return nil
+}
+
+// pullArtifact fetches the OCI artifact at ref and writes its file into outputDir
+func pullArtifact(ref name.Tag, outputDir string, opts ...remote.Option) error {
+	desc, err := remoteGet(ref, opts...)
+	if err != nil {
+		return fmt.Errorf("fetching manifest %s: %v", ref, err)
+	}
+
+	var manifest artifactManifest
+	if err := json.NewDecoder(bytes.NewReader(desc.Manifest)).Decode(&manifest); err != nil {
+		return fmt.Errorf("parsing manifest %s: %v", ref, err)
+	}
+	if manifest.ArtifactType != ArtifactType || len(manifest.Layers) != 1 {
+		return fmt.Errorf("%s is not an RKE2 artifact", ref)
+	}
+
+	file := filepath.Base(manifest.Layers[0].Annotations[annotationTitle])
+	if file == "." || file == "/" {
+		return fmt.Errorf("%s has no file name annotation", ref)
+	}
+
+	layer, err := remoteLayer(ref.Context().Digest(manifest.Layers[0].Digest.String()), opts...)
+	if err != nil {
+		return fmt.Errorf("fetching blob of %s: %v", ref, err)
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("fetching blob of %s: %v", ref, err)
+	}
+	defer rc.Close()
+
+	out, err := os.Create(filepath.Join(outputDir, file))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// Compressed() verifies the digest of the content when the reader is fully consumed
+	if _, err := io.Copy(out, rc); err != nil {
+		os.Remove(out.Name())
+		return fmt.Errorf("writing %s: %v", file, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,71 @@
+package rke2
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/registry"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRKE2_UploadAndPull(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	reg := registry.New("", strings.TrimPrefix(server.URL, "http://"), "", false)
+
+	srcDir := t.TempDir()
+	for _, f := range listRKE2Images {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, f), []byte("content of "+f), 0644))
+	}
+
+	require.NoError(t, New("v1.30.3+rke2r1", srcDir, reg).Upload())
+
+	// The artifacts are tagged with the RKE2 version and typed
+	ref, err := artifactReference(reg.RegistryURL, "sha256sum-amd64.txt", "v1.30.3+rke2r1")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.30.3-rke2r1", ref.TagStr())
+	desc, err := remote.Get(ref)
+	require.NoError(t, err)
+	assert.Contains(t, string(desc.Manifest), ArtifactType)
+
+	dstDir := filepath.Join(t.TempDir(), "pulled")
+	require.NoError(t, New("v1.30.3+rke2r1", dstDir, reg).Pull())
+
+	for _, f := range listRKE2Images {
+		data, err := os.ReadFile(filepath.Join(dstDir, f))
+		require.NoError(t, err)
+		assert.Equal(t, "content of "+f, string(data))
+	}
+}
+
+func TestRKE2_UploadMissingFile(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	reg := registry.New("", strings.TrimPrefix(server.URL, "http://"), "", false)
+
+	err := New("v1.30.3+rke2r1", t.TempDir(), reg).Upload()
+	assert.Error(t, err)
+}
+
+func TestRKE2_PullMissingArtifact(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	reg := registry.New("", strings.TrimPrefix(server.URL, "http://"), "", false)
+
+	err := New("v1.30.3+rke2r1", t.TempDir(), reg).Pull()
+	assert.Error(t, err)
+}
+
+func Test_fileMediaType(t *testing.T) {
+	assert.Equal(t, "application/zstd", string(fileMediaType("rke2-images-core.linux-amd64.tar.zst")))
+	assert.Equal(t, "application/gzip", string(fileMediaType("rke2.linux-amd64.tar.gz")))
+	assert.Equal(t, "text/plain", string(fileMediaType("sha256sum-amd64.txt")))
+}
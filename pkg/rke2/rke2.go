@@ -2,125 +2,305 @@ package rke2
 
 import (
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"text/template"
+
+	"github.com/alknopfler/seactl/pkg/download"
+	"github.com/alknopfler/seactl/pkg/registry"
 )
 
 const (
 	RKE2ReleaseURL = "https://github.com/rancher/rke2/releases/download/"
 	RKE2URL        = "https://get.rke2.io"
+
+	// DefaultArch is the architecture of the release files
+	DefaultArch = "amd64"
 )
 
 var (
 	listRKE2Images = map[string]string{
-		"RKE2ImagesLinux":   "rke2-images.linux-amd64.tar.zst",
+		"RKE2ImagesLinux":   rke2ImagesAll,
 		"RKE2ImagesCalico":  "rke2-images-calico.linux-amd64.tar.zst",
 		"RKE2ImagesFlannel": "rke2-images-flannel.linux-amd64.tar.zst",
 		"RKE2ImagesCilium":  "rke2-images-cilium.linux-amd64.tar.zst",
 		"RKE2ImagesCanal":   "rke2-images-canal.linux-amd64.tar.zst",
 		"RKE2ImagesMultus":  "rke2-images-multus.linux-amd64.tar.zst",
-		"RKE2ImagesCore":    "rke2-images-core.linux-amd64.tar.zst",
-		"RKE2Linux":         "rke2.linux-amd64.tar.gz",
-		"RKE2SHA256":        "sha256sum-amd64.txt",
+		"RKE2ImagesCore":    rke2ImagesCore,
+		"RKE2Linux":         rke2Tarball,
+		"RKE2SHA256":        rke2ChecksumsFile,
 	}
+
+	// SupportedCNIs are the CNI plugins shipped in a dedicated rke2-images-<cni> archive
+	SupportedCNIs = []string{"calico", "canal", "cilium", "flannel", "multus"}
+)
+
+const (
+	rke2ImagesAll     = "rke2-images.linux-amd64.tar.zst"
+	rke2ImagesCore    = "rke2-images-core.linux-amd64.tar.zst"
+	rke2ImagesCNI     = "rke2-images-%s.linux-amd64.tar.zst"
+	rke2Tarball       = "rke2.linux-amd64.tar.gz"
+	rke2ChecksumsFile = "sha256sum-amd64.txt"
 )
 
 type RKE2 struct {
 	Version          string
 	OutputDirTarball string
-	ReleaseURL       string
+	ReleaseURL       string // base URL the version is appended to, or a URL template (see URLData)
+	InstallURL       string // install.sh URL, may be a URL template (see URLData)
+	Arch             string
+	CNIs             []string // when set, only the core archive and these CNI archives are handled
+	reg              *registry.Registry
+}
+
+// URLData holds the fields available in the ReleaseURL and InstallURL templates, e.g.
+// https://artifactory.example.com/rke2/{{.Version}}/ or https://nexus.example.com/rke2/{{.RawVersion}}/
+type URLData struct {
+	Version    string // URL-escaped version, v1.30.3%2Brke2r1
+	RawVersion string // version as found in the release manifest, v1.30.3+rke2r1
+	Arch       string // always amd64 from the CLI, the only architecture generate downloads
 }
 
-func New(version, outputDirTarball string) *RKE2 {
+func New(version, outputDirTarball string, reg *registry.Registry) *RKE2 {
 	return &RKE2{
 		Version:          version,
 		OutputDirTarball: outputDirTarball,
 		ReleaseURL:       RKE2ReleaseURL,
+		InstallURL:       RKE2URL,
+		Arch:             DefaultArch,
+		reg:              reg,
 	}
 }
 
 func (r *RKE2) Download() error {
 	// Create the destination directory if it doesn't exist
 	if err := os.MkdirAll(r.OutputDirTarball, os.ModePerm); err != nil {
-		log.Printf("failed to create destination directory: %v", err)
+		slog.Error("failed to create destination directory", "dir", r.OutputDirTarball, "error", err)
 		return err
 	}
 
 	// Download the install.sh script
-	if getFileFromURL(RKE2URL, "install.sh", ensureTrailingSlash(r.OutputDirTarball)) != nil {
-		return fmt.Errorf("failed to download the install.sh script")
+	installURL, err := RenderURL(r.InstallURL, r.urlData())
+	if err != nil {
+		return err
+	}
+	if err := download.File(installURL, "install.sh", download.EnsureTrailingSlash(r.OutputDirTarball)); err != nil {
+		return fmt.Errorf("failed to download the RKE2 install.sh script: %w", err)
 	}
 
-	// Download the tarball files for the current release
-	for _, image := range listRKE2Images {
-		if getFileFromURL(r.ReleaseURL+replaceVersionLink(r.Version)+"/"+image, image, ensureTrailingSlash(r.OutputDirTarball)) != nil {
-			return fmt.Errorf("failed to download the file: %s", image)
+	// Download the tarball files for the current release, they keep the release file names whatever the
+	// mirror layout is, so they can be verified against the release checksums file
+	for _, image := range r.files() {
+		url, err := r.releaseURL(image)
+		if err != nil {
+			return err
+		}
+		if err := download.File(url, image, download.EnsureTrailingSlash(r.OutputDirTarball)); err != nil {
+			return fmt.Errorf("failed to download the file %s: %w", image, err)
 		}
 	}
 	return nil
 }
 
+// DownloadSize returns the total size of the release files to download, from HEAD requests
+func (r *RKE2) DownloadSize() (int64, error) {
+	var total int64
+	for _, image := range r.files() {
+		url, err := r.releaseURL(image)
+		if err != nil {
+			return 0, err
+		}
+		size, err := download.Size(url)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
 func (r *RKE2) Verify() error {
 	// verify if all images have been downloaded successfully
-	for _, image := range listRKE2Images {
-		filePath := filepath.Join(ensureTrailingSlash(r.OutputDirTarball), image)
+	for _, image := range r.files() {
+		filePath := filepath.Join(download.EnsureTrailingSlash(r.OutputDirTarball), image)
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			log.Printf("file does not exist: %s", filePath)
+			slog.Error("file does not exist", "file", filePath)
 			return err
 		}
-		log.Printf("Image verified successfully: %s", filePath)
 	}
-	return nil
+
+	// verify the checksums of the downloaded subset against the release checksums file
+	return download.VerifyChecksums(r.OutputDirTarball, r.archFile(rke2ChecksumsFile), r.files())
 }
 
+// Upload pushes every tarball and the checksum file to the registry as an OCI artifact of type ArtifactType,
+// at <registry>/rke2/<file>:<version> (the "+" of the version replaced by "-")
 func (r *RKE2) Upload() error {
-	// Upload the tarball files to the registry
-	// TODO: implement me if needed (prepared if we change the airgap with rke2-capi-provider to use registry instead of artifacts)
+	opts, err := r.reg.RemoteOptions()
+	if err != nil {
+		return fmt.Errorf("getting remote options: %v", err)
+	}
+
+	for _, image := range r.files() {
+		ref, err := artifactReference(r.reg.RegistryURL, image, r.Version)
+		if err != nil {
+			return fmt.Errorf("building artifact reference for %s: %v", image, err)
+		}
+		slog.Info("pushing RKE2 artifact", "file", image, "target", ref.String())
+		if err := pushArtifact(ref, filepath.Join(r.OutputDirTarball, image), r.Version, opts...); err != nil {
+			return err
+		}
+	}
+	slog.Info("RKE2 artifacts pushed", "version", r.Version, "registry", r.reg.RegistryURL)
+	return nil
+}
+
+// Pull fetches the artifacts pushed by Upload from the registry into OutputDirTarball, ready to be used
+// with INSTALL_RKE2_ARTIFACT_PATH
+func (r *RKE2) Pull() error {
+	if err := os.MkdirAll(r.OutputDirTarball, os.ModePerm); err != nil {
+		slog.Error("failed to create destination directory", "dir", r.OutputDirTarball, "error", err)
+		return err
+	}
+
+	opts, err := r.reg.RemoteOptions()
+	if err != nil {
+		return fmt.Errorf("getting remote options: %v", err)
+	}
+
+	for _, image := range r.files() {
+		ref, err := artifactReference(r.reg.RegistryURL, image, r.Version)
+		if err != nil {
+			return fmt.Errorf("building artifact reference for %s: %v", image, err)
+		}
+		if err := pullArtifact(ref, r.OutputDirTarball, opts...); err != nil {
+			return err
+		}
+		slog.Info("RKE2 artifact pulled", "file", image, "dir", r.OutputDirTarball)
+	}
 	return nil
 }
 
-func replaceVersionLink(version string) string {
-	return strings.ReplaceAll(version, "+", "%2B")
+// ImageArchives returns the sorted paths of the downloaded docker-archives holding the RKE2 system images
+func (r *RKE2) ImageArchives() []string {
+	var archives []string
+	for _, image := range r.files() {
+		if strings.HasPrefix(image, "rke2-images") {
+			archives = append(archives, filepath.Join(r.OutputDirTarball, image))
+		}
+	}
+	sort.Strings(archives)
+	return archives
+}
+
+// Files returns the names of the release files handled, in OutputDirTarball once downloaded
+func (r *RKE2) Files() []string {
+	return r.files()
 }
 
-func ensureTrailingSlash(dir string) string {
-	if !strings.HasSuffix(dir, "/") {
-		dir += "/"
+// ChecksumsFile returns the name of the release checksums file
+func (r *RKE2) ChecksumsFile() string {
+	return r.archFile(rke2ChecksumsFile)
+}
+
+// ValidateCNIs returns an error if any of cnis is not in SupportedCNIs
+func ValidateCNIs(cnis []string) error {
+	for _, cni := range cnis {
+		supported := false
+		for _, s := range SupportedCNIs {
+			if cni == s {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("unsupported CNI %q, allowed: %s", cni, strings.Join(SupportedCNIs, ", "))
+		}
 	}
-	return dir
+	return nil
 }
 
-func getFileFromURL(url, filename, filePath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Printf("failed to download the file %s, %v", filename, err)
-		return err
+// files returns the release files to handle: all of them when no CNI is selected, otherwise the core
+// archive, the selected CNI archives, the rke2 tarball and the checksums file (the all-in-one
+// rke2-images archive already contains every CNI, so it is skipped)
+func (r *RKE2) files() []string {
+	var files []string
+	if len(r.CNIs) == 0 {
+		for _, image := range listRKE2Images {
+			files = append(files, r.archFile(image))
+		}
+		sort.Strings(files)
+		return files
+	}
+
+	for _, image := range []string{rke2ImagesCore, rke2Tarball, rke2ChecksumsFile} {
+		files = append(files, r.archFile(image))
+	}
+	for _, cni := range r.CNIs {
+		files = append(files, r.archFile(fmt.Sprintf(rke2ImagesCNI, cni)))
 	}
+	sort.Strings(files)
+	return files
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("failed to download the file %s from %s: HTTP status %s", filename, url, resp.Status)
-		return fmt.Errorf("failed to download the file %s from %s: HTTP status %s", filename, url, resp.Status)
+// archFile returns the name of the release file for r.Arch
+func (r *RKE2) archFile(file string) string {
+	if r.Arch == "" || r.Arch == DefaultArch {
+		return file
 	}
+	return strings.ReplaceAll(file, DefaultArch, r.Arch)
+}
 
-	// Create the file
-	out, err := os.Create(filePath + filename)
+func (r *RKE2) urlData() URLData {
+	arch := r.Arch
+	if arch == "" {
+		arch = DefaultArch
+	}
+	return URLData{Version: download.EscapeVersion(r.Version), RawVersion: r.Version, Arch: arch}
+}
 
+// releaseURL returns the URL of a release file. A plain ReleaseURL is a base URL followed by the version,
+// like the GitHub releases; a templated one is rendered and only followed by the file name.
+func (r *RKE2) releaseURL(file string) (string, error) {
+	if !isTemplate(r.ReleaseURL) {
+		return download.EnsureTrailingSlash(r.ReleaseURL) + download.EscapeVersion(r.Version) + "/" + file, nil
+	}
+	base, err := RenderURL(r.ReleaseURL, r.urlData())
 	if err != nil {
-		log.Printf("failed to create file: %v", err)
-		return err
+		return "", err
+	}
+	return download.EnsureTrailingSlash(base) + file, nil
+}
+
+// RenderURL renders the URL template tmpl with data, a URL without template actions is returned as is
+func RenderURL(tmpl string, data URLData) (string, error) {
+	if !isTemplate(tmpl) {
+		return tmpl, nil
 	}
-	_, err = io.Copy(out, resp.Body)
+	t, err := template.New("url").Parse(tmpl)
 	if err != nil {
-		log.Printf("failed to save file: %v", err)
-		return err
+		return "", fmt.Errorf("invalid URL template %q: %v", tmpl, err)
 	}
-	log.Printf("File %s downloaded successfully to %s", filename, filePath)
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid URL template %q: %v", tmpl, err)
+	}
+	return b.String(), nil
+}
 
-	defer resp.Body.Close()
-	defer out.Close()
-	return nil
+// ValidateURLTemplate returns an error if tmpl is not a valid URL template, so mistakes are caught before
+// anything is downloaded
+func ValidateURLTemplate(tmpl string) error {
+	if tmpl == "" {
+		return fmt.Errorf("empty URL")
+	}
+	_, err := RenderURL(tmpl, URLData{Version: "v0.0.0%2Brke2r1", RawVersion: "v0.0.0+rke2r1", Arch: DefaultArch})
+	return err
+}
+
+func isTemplate(url string) bool {
+	return strings.Contains(url, "{{")
 }
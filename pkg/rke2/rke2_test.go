@@ -1,11 +1,15 @@
 package rke2
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -24,62 +28,6 @@ func removeTempDir(t *testing.T, dir string) {
 	}
 }
 
-// --- Tests for getFileFromURL ---
-func Test_getFileFromURL(t *testing.T) {
-	tempDir := createTempDir(t)
-	defer removeTempDir(t, tempDir)
-
-	// Mock HTTP server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/success" {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("file content"))
-			return
-		}
-		w.WriteHeader(http.StatusNotFound)
-	}))
-	defer server.Close()
-
-	tests := []struct {
-		name     string
-		url      string
-		filename string
-		wantErr  bool
-	}{
-		{
-			name:     "Successful download",
-			url:      server.URL + "/success",
-			filename: "file.txt",
-			wantErr:  false,
-		},
-		{
-			name:     "HTTP error",
-			url:      server.URL + "/fail",
-			filename: "file.txt",
-			wantErr:  true,
-		},
-		{
-			name:     "Invalid directory",
-			url:      server.URL + "/success",
-			filename: "file.txt",
-			wantErr:  true, // because invalid path will cause os.Create to fail
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dir := tempDir
-			if tt.name == "Invalid directory" {
-				dir = "/invalid/dir/"
-			}
-			err := getFileFromURL(tt.url, tt.filename, ensureTrailingSlash(dir))
-			if (err != nil) != tt.wantErr {
-				t.Errorf("getFileFromURL() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 // --- Tests for RKE2.Download() ---
 
 func TestRKE2_Download(t *testing.T) {
@@ -99,8 +47,9 @@ func TestRKE2_Download(t *testing.T) {
 	defer server.Close()
 
 	// Create RKE2 instance with mocked ReleaseURL
-	r := New("v1.21.3+rke2r1", tempDir)
+	r := New("v1.21.3+rke2r1", tempDir, nil)
 	r.ReleaseURL = server.URL + "/" // override for testing
+	r.InstallURL = server.URL + "/install.sh"
 
 	// Run Download()
 	if err := r.Download(); err != nil {
@@ -122,12 +71,111 @@ func TestRKE2_Download(t *testing.T) {
 	}
 }
 
+func TestRKE2_DownloadFromMirror(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer removeTempDir(t, tempDir)
+
+	var files []string
+	for _, f := range listRKE2Images {
+		files = append(files, f)
+	}
+	releaseDir := createTempDir(t)
+	defer removeTempDir(t, releaseDir)
+	writeReleaseFiles(t, releaseDir, files)
+	if err := ioutil.WriteFile(filepath.Join(releaseDir, "install.sh"), []byte("#!/bin/sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mirror layout: /rke2/<raw version>/<arch>/<file> and /scripts/<version>/install.sh
+	mux := http.NewServeMux()
+	mux.Handle("/rke2/v1.21.3+rke2r1/amd64/", http.StripPrefix("/rke2/v1.21.3+rke2r1/amd64/", http.FileServer(http.Dir(releaseDir))))
+	mux.HandleFunc("/scripts/v1.21.3+rke2r1/install.sh", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(releaseDir, "install.sh"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	r := New("v1.21.3+rke2r1", tempDir, nil)
+	r.ReleaseURL = server.URL + "/rke2/{{.RawVersion}}/{{.Arch}}"
+	r.InstallURL = server.URL + "/scripts/{{.Version}}/install.sh"
+
+	if err := r.Download(); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	// The files keep their release names, so the checksums file matches them
+	if err := r.Verify(); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestRKE2_releaseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		releaseURL string
+		want       string
+		wantErr    bool
+	}{
+		{"Default", RKE2ReleaseURL, "https://github.com/rancher/rke2/releases/download/v1.21.3%2Brke2r1/rke2.linux-amd64.tar.gz", false},
+		{"Base URL without slash", "https://mirror.local/rke2", "https://mirror.local/rke2/v1.21.3%2Brke2r1/rke2.linux-amd64.tar.gz", false},
+		{"Template", "https://mirror.local/{{.Arch}}/{{.RawVersion}}/", "https://mirror.local/amd64/v1.21.3+rke2r1/rke2.linux-amd64.tar.gz", false},
+		{"Unknown field", "https://mirror.local/{{.Os}}", "", true},
+		{"Invalid template", "https://mirror.local/{{.Version", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New("v1.21.3+rke2r1", "", nil)
+			r.ReleaseURL = tt.releaseURL
+			got, err := r.releaseURL(rke2Tarball)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("releaseURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("releaseURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateURLTemplate(t *testing.T) {
+	if err := ValidateURLTemplate("https://mirror.local/rke2/{{.Version}}/"); err != nil {
+		t.Errorf("ValidateURLTemplate() error = %v", err)
+	}
+	if err := ValidateURLTemplate(RKE2URL); err != nil {
+		t.Errorf("ValidateURLTemplate() error = %v", err)
+	}
+	if err := ValidateURLTemplate("https://mirror.local/{{.Foo}}"); err == nil {
+		t.Errorf("ValidateURLTemplate() should fail for an unknown field")
+	}
+	if err := ValidateURLTemplate(""); err == nil {
+		t.Errorf("ValidateURLTemplate() should fail for an empty URL")
+	}
+}
+
+// writeReleaseFiles creates dummy release files in dir plus a sha256sum file listing them
+func writeReleaseFiles(t *testing.T, dir string, files []string) {
+	t.Helper()
+	var sums strings.Builder
+	for _, f := range files {
+		if f == rke2ChecksumsFile {
+			continue
+		}
+		content := []byte("dummy " + f)
+		if err := ioutil.WriteFile(filepath.Join(dir, f), content, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		fmt.Fprintf(&sums, "%x  %s\n", sha256.Sum256(content), f)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, rke2ChecksumsFile), []byte(sums.String()), 0644); err != nil {
+		t.Fatalf("failed to create checksums file: %v", err)
+	}
+}
+
 // --- Tests for RKE2.Verify() ---
 func TestRKE2_Verify(t *testing.T) {
 	tempDir := createTempDir(t)
 	defer removeTempDir(t, tempDir)
 
-	r := New("v1.21.3+rke2r1", tempDir)
+	r := New("v1.21.3+rke2r1", tempDir, nil)
 
 	// Case: missing files
 	if err := r.Verify(); err == nil {
@@ -135,54 +183,80 @@ func TestRKE2_Verify(t *testing.T) {
 	}
 
 	// Case: all files exist
+	var files []string
 	for _, f := range listRKE2Images {
-		err := ioutil.WriteFile(filepath.Join(tempDir, f), []byte("dummy"), 0644)
-		if err != nil {
-			t.Fatalf("failed to create test file: %v", err)
-		}
+		files = append(files, f)
 	}
+	writeReleaseFiles(t, tempDir, files)
 
 	if err := r.Verify(); err != nil {
 		t.Errorf("Verify() error = %v", err)
 	}
+
+	// Case: corrupted file
+	if err := ioutil.WriteFile(filepath.Join(tempDir, rke2Tarball), []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("failed to corrupt test file: %v", err)
+	}
+	if err := r.Verify(); err == nil {
+		t.Errorf("Verify() should fail when a checksum does not match")
+	}
 }
 
-// --- Existing helper tests ---
-func Test_replaceVersionLink(t *testing.T) {
-	tests := []struct {
-		name    string
-		version string
-		want    string
-	}{
-		{"With plus", "v1.21.3+rke2r1", "v1.21.3%2Brke2r1"},
-		{"Without plus", "v1.21.3", "v1.21.3"},
+func TestRKE2_VerifyCNISubset(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer removeTempDir(t, tempDir)
+
+	r := New("v1.21.3+rke2r1", tempDir, nil)
+	r.CNIs = []string{"cilium", "multus"}
+
+	// Only the core, cilium and multus archives are needed
+	writeReleaseFiles(t, tempDir, r.files())
+	if err := r.Verify(); err != nil {
+		t.Errorf("Verify() error = %v", err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := replaceVersionLink(tt.version); got != tt.want {
-				t.Errorf("replaceVersionLink() = %v, want %v", got, tt.want)
-			}
-		})
+
+	r.CNIs = []string{"calico"}
+	if err := r.Verify(); err == nil {
+		t.Errorf("Verify() should fail when a selected CNI archive is missing")
 	}
 }
 
-func Test_ensureTrailingSlash(t *testing.T) {
-	tests := []struct {
-		name string
-		dir  string
-		want string
-	}{
-		{"No slash", "test", "test/"},
-		{"With slash", "test/", "test/"},
-		{"Relative path with slash", "./test/", "./test/"},
-		{"Nested path with slash", "./aa/test/", "./aa/test/"},
-		{"Nested path no slash", "./aa/test", "./aa/test/"},
+func TestRKE2_files(t *testing.T) {
+	r := New("v1.21.3+rke2r1", "", nil)
+	if got := r.files(); len(got) != len(listRKE2Images) {
+		t.Errorf("files() = %v, want every release file", got)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := ensureTrailingSlash(tt.dir); got != tt.want {
-				t.Errorf("ensureTrailingSlash() = %v, want %v", got, tt.want)
-			}
-		})
+
+	r.CNIs = []string{"multus", "cilium"}
+	want := []string{
+		"rke2-images-cilium.linux-amd64.tar.zst",
+		"rke2-images-core.linux-amd64.tar.zst",
+		"rke2-images-multus.linux-amd64.tar.zst",
+		"rke2.linux-amd64.tar.gz",
+		"sha256sum-amd64.txt",
+	}
+	if got := r.files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("files() = %v, want %v", got, want)
+	}
+
+	r.Arch = "arm64"
+	r.CNIs = []string{"canal"}
+	want = []string{
+		"rke2-images-canal.linux-arm64.tar.zst",
+		"rke2-images-core.linux-arm64.tar.zst",
+		"rke2.linux-arm64.tar.gz",
+		"sha256sum-arm64.txt",
+	}
+	if got := r.files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("files() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateCNIs(t *testing.T) {
+	if err := ValidateCNIs([]string{"cilium", "multus"}); err != nil {
+		t.Errorf("ValidateCNIs() error = %v", err)
+	}
+	if err := ValidateCNIs([]string{"weave"}); err == nil {
+		t.Errorf("ValidateCNIs() should fail for an unsupported CNI")
 	}
 }
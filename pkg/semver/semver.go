@@ -0,0 +1,128 @@
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD], see https://semver.org
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string // e.g. rc1 or build20240801.1, empty for a release
+	Build      string // build metadata, ignored by Compare
+}
+
+// versionRe is the regular expression of semver.org, the numbers have no leading zeros
+var versionRe = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// Parse parses a MAJOR.MINOR.PATCH version with its optional pre-release and build metadata, e.g. 3.1.0,
+// 3.10.2 or 3.2.0-rc1
+func Parse(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid version %q, expected MAJOR.MINOR.PATCH with an optional -PRERELEASE, e.g. 3.1.0 or 3.2.0-rc1", s)
+	}
+	v := Version{Prerelease: m[4], Build: m[5]}
+	var err error
+	for i, n := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if *n, err = strconv.Atoi(m[i+1]); err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %v", s, err)
+		}
+	}
+	return v, nil
+}
+
+// ParseRelease parses a release version: a version without build metadata, as the release manifests are
+// published under the version as OCI tag and "+" is not valid in a tag
+func ParseRelease(s string) (Version, error) {
+	v, err := Parse(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if v.Build != "" {
+		return Version{}, fmt.Errorf("invalid version %q, build metadata (+%s) is not allowed in a release version", s, v.Build)
+	}
+	return v, nil
+}
+
+// String returns the version as parsed
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// MajorMinor returns MAJOR.MINOR, the release stream of the version, e.g. 3.1 for 3.1.2
+func (v Version) MajorMinor() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// IsPrerelease reports whether the version has a pre-release tag
+func (v Version) IsPrerelease() bool {
+	return v.Prerelease != ""
+}
+
+// Compare returns -1, 0 or 1 when v has a lower, the same or a higher precedence than o: the numbers are
+// compared first, then a pre-release is lower than the release and the pre-release identifiers are
+// compared one by one, numerically when both are numbers. The build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	for _, c := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if c[0] != c[1] {
+			return compareInt(c[0], c[1])
+		}
+	}
+
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(o.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(a), len(b))
+}
+
+// compareIdentifier compares two pre-release identifiers, the numeric ones being lower than the others
+func compareIdentifier(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInt(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package semver
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"3.1.0", Version{Major: 3, Minor: 1}},
+		{"3.10.2", Version{Major: 3, Minor: 10, Patch: 2}},
+		{"10.1.0", Version{Major: 10, Minor: 1}},
+		{"3.2.0-rc1", Version{Major: 3, Minor: 2, Prerelease: "rc1"}},
+		{"3.2.0-build20240801.1", Version{Major: 3, Minor: 2, Prerelease: "build20240801.1"}},
+		{"3.2.0-rc.1+sha.5114f85", Version{Major: 3, Minor: 2, Prerelease: "rc.1", Build: "sha.5114f85"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+		assert.Equal(t, tt.in, got.String())
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, in := range []string{"", "3.1", "3.1.x", "v3.1.0", "3.01.0", "3.1.0-", "3.1.0-rc..1", "3.1.0.1", " 3.1.0", "3.1.0-01"} {
+		_, err := Parse(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestParseRelease(t *testing.T) {
+	v, err := ParseRelease("3.2.0-rc1")
+	require.NoError(t, err)
+	assert.Equal(t, "3.2.0-rc1", v.String())
+
+	_, err = ParseRelease("3.2.0+build1")
+	assert.ErrorContains(t, err, "build metadata")
+	_, err = ParseRelease("3.1")
+	assert.Error(t, err)
+}
+
+func TestMajorMinor(t *testing.T) {
+	v, err := Parse("3.10.2-rc1")
+	require.NoError(t, err)
+	assert.Equal(t, "3.10", v.MajorMinor())
+	assert.True(t, v.IsPrerelease())
+}
+
+func TestCompare(t *testing.T) {
+	// semver.org precedence example, plus the numeric ordering of the numbers
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11",
+		"1.0.0-rc.1", "1.0.0", "3.1.0", "3.1.2", "3.2.0-rc1", "3.2.0", "3.10.0", "10.1.0",
+	}
+	var versions []Version
+	for _, s := range []string{"3.10.0", "1.0.0-beta.11", "10.1.0", "1.0.0", "3.2.0", "1.0.0-alpha.beta", "3.1.2",
+		"1.0.0-alpha", "3.2.0-rc1", "1.0.0-rc.1", "1.0.0-beta", "3.1.0", "1.0.0-alpha.1", "1.0.0-beta.2"} {
+		v, err := Parse(s)
+		require.NoError(t, err)
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Compare(versions[j]) < 0 })
+
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, ordered, got)
+
+	a, _ := Parse("3.1.0+build1")
+	b, _ := Parse("3.1.0+build2")
+	assert.Equal(t, 0, a.Compare(b))
+}
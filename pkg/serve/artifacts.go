@@ -0,0 +1,93 @@
+package serve
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultArtifactPath is the directory where the nodes store the RKE2 artifacts before running install.sh
+const DefaultArtifactPath = "/root/rke2-artifacts"
+
+var artifactContentTypes = map[string]string{
+	".zst": "application/zstd",
+	".gz":  "application/gzip",
+	".tar": "application/x-tar",
+	".txt": "text/plain; charset=utf-8",
+	".sh":  "text/x-shellscript; charset=utf-8",
+}
+
+// NewArtifactsHandler serves the files in dir (the RKE2 artifacts and install.sh) with their content
+// types, with range requests support so interrupted downloads on the nodes can be resumed
+func NewArtifactsHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct, ok := artifactContentTypes[filepath.Ext(r.URL.Path)]; ok {
+			w.Header().Set("Content-Type", ct)
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// ArtifactFiles returns the sorted file names in dir needed to install RKE2 with INSTALL_RKE2_ARTIFACT_PATH
+func ArtifactFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading artifacts directory %s: %v", dir, err)
+	}
+
+	var files []string
+	installScript, tarball := false, false
+	for _, entry := range entries {
+		n := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		switch {
+		case n == "install.sh":
+			installScript = true
+		case strings.HasPrefix(n, "rke2.linux-") && strings.HasSuffix(n, ".tar.gz"):
+			tarball = true
+		case strings.HasPrefix(n, "rke2-images") && isArchive(n):
+		case strings.HasPrefix(n, "sha256sum-") && strings.HasSuffix(n, ".txt"):
+		default:
+			continue
+		}
+		files = append(files, n)
+	}
+	sort.Strings(files)
+
+	if !installScript || !tarball {
+		return nil, fmt.Errorf("install.sh or the rke2 tarball not found in %s, run generate first", dir)
+	}
+	return files, nil
+}
+
+// isArchive reports whether name is a finished archive, not a .part download or a .tmp file being written
+func isArchive(name string) bool {
+	for _, suffix := range []string{".tar", ".tar.gz", ".tar.zst"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallInstructions returns the shell commands a node runs to install RKE2 from the artifacts served at baseURL
+func InstallInstructions(baseURL string, files []string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	var b strings.Builder
+	if strings.HasPrefix(baseURL, "https://") {
+		b.WriteString("# add --cacert <ca.crt> to the curl commands if the node does not trust the server certificate\n")
+	}
+	fmt.Fprintf(&b, "mkdir -p %s && cd %s\n", DefaultArtifactPath, DefaultArtifactPath)
+	for _, f := range files {
+		fmt.Fprintf(&b, "curl -sfL -C - -o %s %s/%s\n", f, baseURL, f)
+	}
+	fmt.Fprintf(&b, "INSTALL_RKE2_ARTIFACT_PATH=%s sh install.sh\n", DefaultArtifactPath)
+	return b.String()
+}
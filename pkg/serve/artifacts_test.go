@@ -0,0 +1,89 @@
+package serve
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeArtifacts(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, n := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, n), []byte("0123456789"), 0644))
+	}
+	return dir
+}
+
+func TestArtifactsHandler_ContentTypeAndRange(t *testing.T) {
+	dir := writeArtifacts(t, "install.sh", "rke2-images-core.linux-amd64.tar.zst", "rke2.linux-amd64.tar.gz", "sha256sum-amd64.txt")
+	server := httptest.NewServer(NewArtifactsHandler(dir))
+	defer server.Close()
+
+	tests := []struct {
+		file        string
+		contentType string
+	}{
+		{"install.sh", "text/x-shellscript; charset=utf-8"},
+		{"rke2-images-core.linux-amd64.tar.zst", "application/zstd"},
+		{"rke2.linux-amd64.tar.gz", "application/gzip"},
+		{"sha256sum-amd64.txt", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/" + tt.file)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/rke2.linux-amd64.tar.gz", nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=5-")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "56789", string(body))
+}
+
+func TestArtifactFiles(t *testing.T) {
+	dir := writeArtifacts(t, "install.sh", "rke2-images-core.linux-amd64.tar.zst", "rke2.linux-amd64.tar.gz", "sha256sum-amd64.txt", "rke2-images-edge.linux-amd64.tar.zst", "notes.md")
+
+	files, err := ArtifactFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"install.sh", "rke2-images-core.linux-amd64.tar.zst", "rke2-images-edge.linux-amd64.tar.zst", "rke2.linux-amd64.tar.gz", "sha256sum-amd64.txt"}, files)
+}
+
+func TestArtifactFiles_SkipsUnfinished(t *testing.T) {
+	dir := writeArtifacts(t, "install.sh", "rke2.linux-amd64.tar.gz", "rke2-images-core.linux-amd64.tar.zst",
+		"rke2-images-canal.linux-amd64.tar.zst.part", "rke2-images-canal.linux-amd64.tar.zst.part.validator",
+		"rke2-images-edge.linux-amd64.tar.zst.tmp")
+
+	files, err := ArtifactFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"install.sh", "rke2-images-core.linux-amd64.tar.zst", "rke2.linux-amd64.tar.gz"}, files)
+}
+
+func TestArtifactFiles_Missing(t *testing.T) {
+	_, err := ArtifactFiles(writeArtifacts(t, "sha256sum-amd64.txt"))
+	assert.Error(t, err)
+}
+
+func TestInstallInstructions(t *testing.T) {
+	out := InstallInstructions("https://jumphost:8080/", []string{"install.sh", "rke2.linux-amd64.tar.gz"})
+
+	assert.Contains(t, out, "--cacert")
+	assert.Contains(t, out, "curl -sfL -C - -o rke2.linux-amd64.tar.gz https://jumphost:8080/rke2.linux-amd64.tar.gz\n")
+	assert.Contains(t, out, "INSTALL_RKE2_ARTIFACT_PATH="+DefaultArtifactPath+" sh install.sh")
+}
@@ -0,0 +1,397 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alknopfler/seactl/pkg/images"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+type manifest struct {
+	mediaType types.MediaType
+	raw       []byte
+}
+
+type blob struct {
+	size int64
+	path string // file backed blobs (OCI layouts), served with range support
+	open func() (io.ReadCloser, error)
+}
+
+// Registry is a read-only OCI distribution API server backed by OCI layouts and docker-archive tarballs
+type Registry struct {
+	manifests map[v1.Hash]manifest
+	blobs     map[v1.Hash]blob
+	tags      map[string]map[string]v1.Hash // repository -> tag -> manifest digest
+	sources   map[string]string             // repository -> source registry of its images
+	cleanups  []func()
+}
+
+// errRepositoryConflict is returned when images of two source registries share a repository path, the
+// registry host being dropped from the served repositories
+var errRepositoryConflict = errors.New("repository served for two source registries")
+
+// NewRegistry indexes dir, which is either an OCI image-layout or a bundle directory (like the generate
+// output directory) containing OCI layouts and docker-archive tarballs (*.tar, *.tar.zst). The loading stops,
+// removing the files decompressed so far, when ctx is cancelled.
+func NewRegistry(ctx context.Context, dir string) (*Registry, error) {
+	r := &Registry{
+		manifests: map[v1.Hash]manifest{},
+		blobs:     map[v1.Hash]blob{},
+		tags:      map[string]map[string]v1.Hash{},
+		sources:   map[string]string{},
+	}
+
+	if isLayout(dir) {
+		if err := r.addLayout(dir); err != nil {
+			r.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle directory %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			r.Close()
+			return nil, err
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir() && isLayout(path):
+			err = r.addLayout(path)
+		case strings.HasSuffix(entry.Name(), ".tar"), strings.HasSuffix(entry.Name(), ".tar.zst"):
+			err = r.addArchive(path)
+		default:
+			continue
+		}
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+
+	if len(r.manifests) == 0 {
+		r.Close()
+		return nil, fmt.Errorf("no images found in %s", dir)
+	}
+	return r, nil
+}
+
+// Close removes the temporary files created to decompress the zstd archives
+func (r *Registry) Close() {
+	for _, cleanup := range r.cleanups {
+		cleanup()
+	}
+	r.cleanups = nil
+}
+
+// Repositories returns the sorted list of served repositories
+func (r *Registry) Repositories() []string {
+	var repos []string
+	for repo := range r.tags {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+func isLayout(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "oci-layout"))
+	return err == nil
+}
+
+func (r *Registry) addLayout(dir string) error {
+	p, err := layout.FromPath(dir)
+	if err != nil {
+		return fmt.Errorf("reading OCI layout %s: %v", dir, err)
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		return fmt.Errorf("reading OCI layout %s index: %v", dir, err)
+	}
+	idx, err := ii.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("reading OCI layout %s index: %v", dir, err)
+	}
+
+	for _, desc := range idx.Manifests {
+		if err := r.addLayoutManifest(p, desc); err != nil {
+			return err
+		}
+		refName := desc.Annotations[images.AnnotationRefName]
+		if refName == "" {
+			continue
+		}
+		if err := r.tag(refName, desc.Digest); errors.Is(err, errRepositoryConflict) {
+			return fmt.Errorf("loading image %q from OCI layout %s: %w", refName, dir, err)
+		} else if err != nil {
+			slog.Warn("skipping invalid image reference", "image", refName, "layout", dir, "error", err)
+		}
+	}
+	slog.Info("OCI layout loaded", "layout", dir, "entries", len(idx.Manifests))
+	return nil
+}
+
+// addLayoutManifest registers the manifest (or index, recursively) and all the blobs it references
+func (r *Registry) addLayoutManifest(p layout.Path, desc v1.Descriptor) error {
+	raw, err := p.Bytes(desc.Digest)
+	if err != nil {
+		return fmt.Errorf("reading manifest %s: %v", desc.Digest, err)
+	}
+	r.manifests[desc.Digest] = manifest{mediaType: desc.MediaType, raw: raw}
+
+	if desc.MediaType.IsIndex() {
+		child, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return fmt.Errorf("parsing index %s: %v", desc.Digest, err)
+		}
+		for _, d := range child.Manifests {
+			if err := r.addLayoutManifest(p, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	m, err := v1.ParseManifest(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("parsing manifest %s: %v", desc.Digest, err)
+	}
+	for _, d := range append([]v1.Descriptor{m.Config}, m.Layers...) {
+		r.blobs[d.Digest] = blob{
+			size: d.Size,
+			path: filepath.Join(string(p), "blobs", d.Digest.Algorithm, d.Digest.Hex),
+		}
+	}
+	return nil
+}
+
+func (r *Registry) addArchive(path string) error {
+	imgs, cleanup, err := images.LoadArchive(path, nil)
+	r.cleanups = append(r.cleanups, cleanup)
+	if errors.Is(err, images.ErrNotDockerArchive) {
+		// Not every tarball in the bundle is a docker-archive
+		slog.Info("skipping file, not a docker-archive", "file", path, "error", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, img := range imgs {
+		if err := r.addImage(img.ImageRef, img.Name); err != nil {
+			return fmt.Errorf("loading image %q from %s: %w", img.Name, path, err)
+		}
+	}
+	return nil
+}
+
+func (r *Registry) addImage(img v1.Image, ref string) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return err
+	}
+	raw, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	r.manifests[digest] = manifest{mediaType: mt, raw: raw}
+
+	cfgName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	cfg, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	r.blobs[cfgName] = blob{
+		size: int64(len(cfg)),
+		open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(cfg)), nil },
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	for _, l := range layers {
+		desc, err := partial.Descriptor(l)
+		if err != nil {
+			return err
+		}
+		r.blobs[desc.Digest] = blob{size: desc.Size, open: l.Compressed}
+	}
+
+	return r.tag(ref, digest)
+}
+
+// tag records ref (a full image reference) as repository:tag pointing to digest. The repository is served
+// without the registry host, so the images of another source registry with the same path are rejected.
+func (r *Registry) tag(ref string, digest v1.Hash) error {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	repo := parsed.Context().RepositoryStr()
+	source := parsed.Context().RegistryStr()
+	if other, ok := r.sources[repo]; ok && other != source {
+		return fmt.Errorf("%w: %s from %s and %s", errRepositoryConflict, repo, other, source)
+	}
+	r.sources[repo] = source
+	if r.tags[repo] == nil {
+		r.tags[repo] = map[string]v1.Hash{}
+	}
+	if t, ok := parsed.(name.Tag); ok {
+		r.tags[repo][t.TagStr()] = digest
+	}
+	return nil
+}
+
+// ServeHTTP implements the read-only subset of the OCI distribution API needed to pull images
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "this registry is read-only")
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case req.URL.Path == "/v2/" || req.URL.Path == "/v2":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	case path == "_catalog":
+		writeJSON(w, map[string][]string{"repositories": r.Repositories()})
+	case strings.HasSuffix(path, "/tags/list"):
+		r.serveTags(w, strings.TrimSuffix(path, "/tags/list"))
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		r.serveManifest(w, req, path[:i], path[i+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		r.serveBlob(w, req, path[i+len("/blobs/"):])
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown endpoint")
+	}
+}
+
+func (r *Registry) serveTags(w http.ResponseWriter, repo string) {
+	tags, ok := r.tags[repo]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	list := []string{}
+	for t := range tags {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	writeJSON(w, map[string]interface{}{"name": repo, "tags": list})
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, repo, reference string) {
+	digest, err := v1.NewHash(reference)
+	if err != nil {
+		var ok bool
+		if digest, ok = r.tags[repo][reference]; !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+	}
+	m, ok := r.manifests[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+
+	w.Header().Set("Content-Type", string(m.mediaType))
+	w.Header().Set("Docker-Content-Digest", digest.String())
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.raw)))
+	if req.Method == http.MethodGet {
+		w.Write(m.raw)
+	}
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, reference string) {
+	digest, err := v1.NewHash(reference)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+		return
+	}
+	b, ok := r.blobs[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest.String())
+
+	if b.path != "" {
+		f, err := os.Open(b.path)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+			return
+		}
+		defer f.Close()
+		var modTime time.Time
+		if fi, err := f.Stat(); err == nil {
+			modTime = fi.ModTime()
+		}
+		http.ServeContent(w, req, "", modTime, f)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(b.size, 10))
+	if req.Method == http.MethodHead {
+		return
+	}
+	rc, err := b.open()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	defer rc.Close()
+	if _, err := io.Copy(w, rc); err != nil {
+		slog.Error("failed to serve blob", "digest", digest.String(), "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
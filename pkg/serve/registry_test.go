@@ -0,0 +1,178 @@
+package serve
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alknopfler/seactl/pkg/images"
+	"github.com/alknopfler/seactl/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomImage(t *testing.T, ref string) *images.Images {
+	t.Helper()
+	ri, err := random.Image(512, 2)
+	require.NoError(t, err)
+	img := images.New(ref, registry.New("", "", "", false))
+	img.ImageRef = ri
+	return img
+}
+
+// pull fetches repo:tag from the test server and checks it matches want
+func pull(t *testing.T, server *httptest.Server, ref string, want v1.Image) {
+	t.Helper()
+	host := strings.TrimPrefix(server.URL, "http://")
+	tag, err := name.NewTag(host+"/"+ref, name.Insecure)
+	require.NoError(t, err)
+
+	got, err := remote.Image(tag)
+	require.NoError(t, err)
+
+	gotDigest, err := got.Digest()
+	require.NoError(t, err)
+	wantDigest, err := want.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, gotDigest)
+
+	layers, err := got.Layers()
+	require.NoError(t, err)
+	for _, l := range layers {
+		rc, err := l.Compressed()
+		require.NoError(t, err)
+		rc.Close()
+	}
+}
+
+func TestRegistry_ServeLayout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "oci")
+	img := randomImage(t, "registry.suse.com/edge/3.4/app:1.0")
+	require.NoError(t, img.SaveToLayout(dir))
+
+	reg, err := NewRegistry(context.Background(), dir)
+	require.NoError(t, err)
+	defer reg.Close()
+	assert.Equal(t, []string{"edge/3.4/app"}, reg.Repositories())
+
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	pull(t, server, "edge/3.4/app:1.0", img.ImageRef)
+
+	// Range requests on file backed blobs
+	layers, err := img.ImageRef.Layers()
+	require.NoError(t, err)
+	digest, err := layers[0].Digest()
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/edge/3.4/app/blobs/"+digest.String(), nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=0-9")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+}
+
+func TestRegistry_ServeBundleArchives(t *testing.T) {
+	dir := t.TempDir()
+	img := randomImage(t, "registry.suse.com/edge/app:2.0")
+	_, err := images.WriteArchives([]*images.Images{img}, dir, images.ArchiveFormatTarZstd, 0)
+	require.NoError(t, err)
+
+	reg, err := NewRegistry(context.Background(), dir)
+	require.NoError(t, err)
+	defer reg.Close()
+
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	pull(t, server, "edge/app:2.0", img.ImageRef)
+}
+
+func TestRegistry_ReadOnly(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "oci")
+	require.NoError(t, randomImage(t, "registry.io/team/app:1.0").SaveToLayout(dir))
+
+	reg, err := NewRegistry(context.Background(), dir)
+	require.NoError(t, err)
+	defer reg.Close()
+
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v2/team/app/blobs/uploads/", "application/octet-stream", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/v2/team/app/manifests/missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/v2/team/app/tags/list")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestNewRegistry_RepositoryConflict(t *testing.T) {
+	dir := t.TempDir()
+	imgs := []*images.Images{randomImage(t, "docker.io/library/app:1.0"), randomImage(t, "registry.suse.com/library/app:1.0")}
+	_, err := images.WriteArchives(imgs, dir, images.ArchiveFormatTar, 0)
+	require.NoError(t, err)
+
+	_, err = NewRegistry(context.Background(), dir)
+	assert.ErrorIs(t, err, errRepositoryConflict)
+	assert.ErrorContains(t, err, "library/app from index.docker.io and registry.suse.com")
+
+	layoutDir := filepath.Join(t.TempDir(), "oci")
+	for _, img := range imgs {
+		require.NoError(t, img.SaveToLayout(layoutDir))
+	}
+	_, err = NewRegistry(context.Background(), layoutDir)
+	assert.ErrorIs(t, err, errRepositoryConflict)
+}
+
+func TestNewRegistry_EmptyDir(t *testing.T) {
+	_, err := NewRegistry(context.Background(), t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestNewRegistry_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	_, err := images.WriteArchives([]*images.Images{randomImage(t, "registry.io/team/app:1.0")}, dir, images.ArchiveFormatTarZstd, 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewRegistry(ctx, dir)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRegistry_CloseRemovesDecompressedArchives(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	dir := t.TempDir()
+	_, err := images.WriteArchives([]*images.Images{randomImage(t, "registry.io/team/app:1.0")}, dir, images.ArchiveFormatTarZstd, 0)
+	require.NoError(t, err)
+
+	reg, err := NewRegistry(context.Background(), dir)
+	require.NoError(t, err)
+	entries, _ := os.ReadDir(tmp)
+	assert.Len(t, entries, 1)
+
+	reg.Close()
+	entries, _ = os.ReadDir(tmp)
+	assert.Empty(t, entries)
+}
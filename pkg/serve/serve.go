@@ -0,0 +1,56 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout bounds the time given to the in-flight requests once the server is stopped
+var shutdownTimeout = 10 * time.Second
+
+// ListenAndServe serves handler on addr, over HTTPS when both certFile and keyFile are provided, until ctx
+// is cancelled: the server then stops accepting connections and waits for the in-flight requests
+func ListenAndServe(ctx context.Context, addr, certFile, keyFile string, handler http.Handler) error {
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("both TLS certificate and key are required to serve over HTTPS")
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           logRequests(handler),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		slog.Info("shutting down the server", "addr", addr)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		stopped <- server.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if certFile != "" {
+		slog.Info("serving", "url", "https://"+addr)
+		err = server.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		slog.Info("serving", "url", "http://"+addr)
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-stopped
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
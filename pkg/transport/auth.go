@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// authFile is a docker config.json or a podman/containers auth.json
+type authFile struct {
+	Auths map[string]authn.AuthConfig `json:"auths"`
+}
+
+// keychain resolves the credentials of a registry from an auth file, anonymous for the registries not listed
+type keychain struct {
+	auths map[string]authn.AuthConfig // by registry host
+}
+
+// readAuthFile loads the auth file at path, the entries are keyed by registry host: the scheme and the
+// repository paths of the keys are dropped, and the Docker Hub aliases are stored under name.DefaultRegistry
+func readAuthFile(path string) (*keychain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading source auth file: %v", err)
+	}
+	var f authFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing source auth file %s: %v", path, err)
+	}
+
+	k := &keychain{auths: map[string]authn.AuthConfig{}}
+	for key, cfg := range f.Auths {
+		host := registryHost(key)
+		if _, ok := k.auths[host]; ok && host != key {
+			// an exact host entry wins over a repository scoped one
+			continue
+		}
+		k.auths[host] = cfg
+	}
+	return k, nil
+}
+
+func registryHost(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return name.DefaultRegistry
+	}
+	return host
+}
+
+func (k *keychain) Resolve(res authn.Resource) (authn.Authenticator, error) {
+	cfg, ok := k.auths[res.RegistryStr()]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(cfg), nil
+}
+
+// SourceKeychain returns the credentials of the source registries from the source auth file, anonymous when
+// none is configured
+func SourceKeychain() authn.Keychain {
+	mu.RLock()
+	defer mu.RUnlock()
+	if sourceAuth == nil {
+		return authn.NewMultiKeychain()
+	}
+	return sourceAuth
+}
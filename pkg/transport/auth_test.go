@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAuthFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+// resolve returns the user and password resolved for the repository of image
+func resolve(t *testing.T, image string) [2]string {
+	t.Helper()
+	ref, err := name.ParseReference(image)
+	require.NoError(t, err)
+	auth, err := SourceKeychain().Resolve(ref.Context())
+	require.NoError(t, err)
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	return [2]string{cfg.Username, cfg.Password}
+}
+
+func TestSourceKeychain(t *testing.T) {
+	reset(t)
+
+	// user:pass
+	path := writeAuthFile(t, `{"auths": {
+		"registry.suse.com": {"auth": "dXNlcjpwYXNz"},
+		"https://index.docker.io/v1/": {"username": "hub", "password": "secret"},
+		"quay.io/jetstack": {"auth": "dXNlcjpwYXNz"}
+	}}`)
+	require.NoError(t, Configure(Settings{SourceAuthFile: path}))
+
+	assert.Equal(t, [2]string{"user", "pass"}, resolve(t, "registry.suse.com/edge/3.1/kubevirt-chart:0.4.0"))
+	assert.Equal(t, [2]string{"hub", "secret"}, resolve(t, "nginx:1.27"))
+	assert.Equal(t, [2]string{"user", "pass"}, resolve(t, "quay.io/jetstack/cert-manager-controller:v1.15"))
+	assert.Equal(t, [2]string{}, resolve(t, "ghcr.io/foo/bar:1"))
+}
+
+func TestSourceKeychain_Anonymous(t *testing.T) {
+	reset(t)
+	assert.Equal(t, [2]string{}, resolve(t, "registry.suse.com/edge/foo:1"))
+}
+
+func TestConfigure_InvalidAuthFile(t *testing.T) {
+	reset(t)
+	assert.Error(t, Configure(Settings{SourceAuthFile: "/does/not/exist.json"}))
+	assert.Error(t, Configure(Settings{SourceAuthFile: writeAuthFile(t, "not json")}))
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// systemCABundles are the system CA bundles read by crypto/x509, the first one found is used
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian/Ubuntu/Gentoo etc.
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora/RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS/RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine Linux, macOS
+}
+
+var sourceBundle string
+
+// SourceCABundle returns a PEM file with the system roots followed by the source CA bundle, empty when no
+// source CA bundle is configured. It is meant for the tools like helm whose --ca-file replaces the system
+// roots instead of adding to them. The file is written once per settings and removed by Cleanup.
+func SourceCABundle() (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if settings.SourceCACert == "" || sourceBundle != "" {
+		return sourceBundle, nil
+	}
+
+	ca, err := os.ReadFile(settings.SourceCACert)
+	if err != nil {
+		return "", fmt.Errorf("reading CA certificate: %v", err)
+	}
+	var bundle bytes.Buffer
+	if roots := systemRoots(); len(roots) > 0 {
+		bundle.Write(roots)
+		if !bytes.HasSuffix(roots, []byte("\n")) {
+			bundle.WriteByte('\n')
+		}
+	}
+	bundle.Write(ca)
+
+	f, err := os.CreateTemp("", "seactl-ca-*.pem")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(bundle.Bytes()); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("writing CA bundle: %v", err)
+	}
+	sourceBundle = f.Name()
+	return sourceBundle, nil
+}
+
+// Cleanup removes the files written for the child processes, see SourceCABundle
+func Cleanup() {
+	mu.Lock()
+	defer mu.Unlock()
+	cleanup()
+}
+
+func cleanup() {
+	if sourceBundle != "" {
+		os.Remove(sourceBundle)
+		sourceBundle = ""
+	}
+}
+
+// systemRoots returns the PEM system roots: $SSL_CERT_FILE, or the first system bundle found
+func systemRoots() []byte {
+	files := systemCABundles
+	if f := os.Getenv("SSL_CERT_FILE"); f != "" {
+		files = []string{f}
+	}
+	for _, file := range files {
+		if data, err := os.ReadFile(file); err == nil {
+			return data
+		}
+	}
+	return nil
+}
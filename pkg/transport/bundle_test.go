@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCA writes the certificate of a test TLS server as a PEM bundle
+func writeCA(t *testing.T, dir string) (string, []byte) {
+	t.Helper()
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	path := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(path, certPEM, 0644))
+	return path, certPEM
+}
+
+func TestSourceCABundle(t *testing.T) {
+	reset(t)
+	dir := t.TempDir()
+	// crypto/x509 loads the real system roots once per process, only the bundle reads this one
+	systemPEM := []byte("-----BEGIN CERTIFICATE-----\nc3lzdGVt\n-----END CERTIFICATE-----")
+	system := filepath.Join(dir, "system.pem")
+	require.NoError(t, os.WriteFile(system, systemPEM, 0644))
+	t.Setenv("SSL_CERT_FILE", "")
+	orig := systemCABundles
+	systemCABundles = []string{filepath.Join(dir, "missing.pem"), system}
+	defer func() { systemCABundles = orig }()
+	ca, caPEM := writeCA(t, dir)
+
+	// nothing to add to the system roots
+	require.NoError(t, Configure(Settings{}))
+	bundle, err := SourceCABundle()
+	require.NoError(t, err)
+	assert.Empty(t, bundle)
+
+	require.NoError(t, Configure(Settings{SourceCACert: ca}))
+	bundle, err = SourceCABundle()
+	require.NoError(t, err)
+	data, err := os.ReadFile(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, string(systemPEM)+"\n"+string(caPEM), string(data))
+
+	// written once
+	again, err := SourceCABundle()
+	require.NoError(t, err)
+	assert.Equal(t, bundle, again)
+
+	Cleanup()
+	_, err = os.Stat(bundle)
+	assert.True(t, os.IsNotExist(err))
+}
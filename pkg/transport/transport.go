@@ -0,0 +1,248 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings are the outbound HTTP settings shared by every client of a run
+type Settings struct {
+	// Proxy is used for every request instead of HTTPS_PROXY/HTTP_PROXY, NO_PROXY is still honoured
+	Proxy string
+	// SourceCACert is a CA bundle trusted, on top of the system roots, on the source side: release manifest,
+	// images, charts and RKE2/K3s downloads. The target registry uses its own --registry-cacert.
+	SourceCACert string
+	// SourceAuthFile is a docker/podman auth.json with the credentials of the source registries: release
+	// manifest, images and OCI charts. The target registry uses its own --registry-authfile.
+	SourceAuthFile string
+}
+
+var (
+	mu       sync.RWMutex
+	settings Settings
+	proxyURL *url.URL
+	source   *http.Transport
+
+	sourceAuth *keychain
+)
+
+// Configure validates and applies s to every transport created afterwards
+func Configure(s Settings) error {
+	var u *url.URL
+	if s.Proxy != "" {
+		parsed, err := url.Parse(s.Proxy)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q, expected http(s)://host:port", s.Proxy)
+		}
+		u = parsed
+	}
+
+	src, err := newTransport(TLS{CACert: s.SourceCACert}, u)
+	if err != nil {
+		return err
+	}
+
+	var auth *keychain
+	if s.SourceAuthFile != "" {
+		if auth, err = readAuthFile(s.SourceAuthFile); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	cleanup()
+	settings, proxyURL, source, sourceAuth = s, u, src, auth
+	return nil
+}
+
+// Current returns the applied settings
+func Current() Settings {
+	mu.RLock()
+	defer mu.RUnlock()
+	return settings
+}
+
+// Source returns the shared transport for the source side, honouring the proxy and the source CA bundle
+func Source() *http.Transport {
+	mu.RLock()
+	src := source
+	mu.RUnlock()
+	if src != nil {
+		return src
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if source == nil {
+		// no CA bundle to load, it cannot fail
+		source, _ = newTransport(TLS{}, proxyURL)
+	}
+	return source
+}
+
+// TLS are the TLS settings of a transport
+type TLS struct {
+	CACert     string // CA bundle trusted on top of the system roots
+	ClientCert string // client certificate for mutual TLS, with ClientKey
+	ClientKey  string
+	Insecure   bool // skip the server certificate verification
+}
+
+// New returns a transport honouring the proxy settings with the given TLS settings
+func New(opts TLS) (*http.Transport, error) {
+	mu.RLock()
+	u := proxyURL
+	mu.RUnlock()
+	return newTransport(opts, u)
+}
+
+func newTransport(opts TLS, proxy *url.URL) (*http.Transport, error) {
+	tlsConfig := &tls.Config{}
+	if opts.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+	} else if opts.CACert != "" {
+		pool, err := CertPool(opts.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be provided together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Transport{
+		Proxy:                 proxyFunc(proxy),
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   10,
+	}, nil
+}
+
+// CertPool returns the system roots plus the certificates of the PEM bundle at path
+func CertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA certificate: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// proxyFunc uses proxy unless the host is in NO_PROXY, or the proxy environment when proxy is nil
+func proxyFunc(proxy *url.URL) func(*http.Request) (*url.URL, error) {
+	if proxy == nil {
+		return http.ProxyFromEnvironment
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Host, noProxy()) {
+			return nil, nil
+		}
+		return proxy, nil
+	}
+}
+
+func noProxy() string {
+	if v := os.Getenv("NO_PROXY"); v != "" {
+		return v
+	}
+	return os.Getenv("no_proxy")
+}
+
+// bypassProxy reports whether host (host or host:port) matches the NO_PROXY list: "*", IPs, CIDRs,
+// host:port and domain names (matching their subdomains too). Loopback hosts are never proxied.
+func bypassProxy(host, noProxy string) bool {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.ToLower(hostname)
+
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if hostname == entry || strings.HasSuffix(hostname, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Environ returns env (the current environment when nil) with the explicit proxy exported, for the
+// helm and podman child processes
+func Environ(env []string) []string {
+	mu.RLock()
+	u := proxyURL
+	mu.RUnlock()
+	if u == nil {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(env,
+		"HTTP_PROXY="+u.String(), "HTTPS_PROXY="+u.String(),
+		"http_proxy="+u.String(), "https_proxy="+u.String(),
+	)
+}
@@ -0,0 +1,185 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reset(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { Configure(Settings{}) })
+}
+
+func TestConfigure(t *testing.T) {
+	reset(t)
+
+	assert.NoError(t, Configure(Settings{Proxy: "http://proxy.local:3128"}))
+	assert.Equal(t, "http://proxy.local:3128", Current().Proxy)
+
+	assert.Error(t, Configure(Settings{Proxy: "proxy.local"}))
+	assert.Error(t, Configure(Settings{SourceCACert: "/does/not/exist.pem"}))
+}
+
+func TestNew_ExplicitProxy(t *testing.T) {
+	reset(t)
+	t.Setenv("NO_PROXY", "internal.local,10.0.0.0/8")
+	assert.NoError(t, Configure(Settings{Proxy: "http://proxy.local:3128"}))
+
+	tr, err := New(TLS{})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://registry.suse.com/v2/", "http://proxy.local:3128"},
+		{"https://registry.internal.local/v2/", ""},
+		{"https://10.1.2.3:5000/v2/", ""},
+		{"http://127.0.0.1:8080/", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		got, err := tr.Proxy(req)
+		assert.NoError(t, err)
+		if tt.want == "" {
+			assert.Nil(t, got, tt.url)
+		} else {
+			assert.Equal(t, tt.want, got.String(), tt.url)
+		}
+	}
+}
+
+func TestSource_UsesSourceCA(t *testing.T) {
+	reset(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Without the CA bundle the server certificate is not trusted
+	assert.NoError(t, Configure(Settings{}))
+	_, err := (&http.Client{Transport: Source()}).Get(server.URL)
+	assert.Error(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, certPEM, 0644))
+
+	assert.NoError(t, Configure(Settings{SourceCACert: caFile}))
+	resp, err := (&http.Client{Transport: Source()}).Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestCertPool_InvalidPEM(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0644))
+
+	_, err := CertPool(caFile)
+	assert.Error(t, err)
+}
+
+func Test_bypassProxy(t *testing.T) {
+	tests := []struct {
+		host    string
+		noProxy string
+		want    bool
+	}{
+		{"registry.suse.com", "", false},
+		{"localhost:5000", "", true},
+		{"registry.suse.com", "*", true},
+		{"registry.suse.com", "suse.com", true},
+		{"registry.suse.com", ".suse.com", true},
+		{"registry.suse.com", "*.suse.com", true},
+		{"notsuse.com", "suse.com", false},
+		{"registry.local:5000", "registry.local:5000", true},
+		{"registry.local:443", "registry.local:5000", false},
+		{"192.168.1.10:5000", "192.168.0.0/16", true},
+		{"192.168.1.10", "192.168.1.10", true},
+		{"172.16.0.1", "192.168.0.0/16", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+"_"+tt.noProxy, func(t *testing.T) {
+			assert.Equal(t, tt.want, bypassProxy(tt.host, tt.noProxy))
+		})
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	reset(t)
+
+	assert.NoError(t, Configure(Settings{}))
+	assert.Nil(t, Environ(nil))
+
+	assert.NoError(t, Configure(Settings{Proxy: "http://proxy.local:3128"}))
+	env := Environ([]string{"FOO=bar"})
+	assert.Contains(t, env, "FOO=bar")
+	assert.Contains(t, env, "HTTPS_PROXY=http://proxy.local:3128")
+	assert.True(t, len(Environ(nil)) > 0)
+}
+
+// writeClientCert generates a self-signed client certificate and key in dir
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "seactl"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestNew_ClientCert(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	certFile, keyFile := writeClientCert(t, t.TempDir())
+
+	// The server rejects clients without certificate
+	tr, err := New(TLS{Insecure: true})
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: tr}).Get(server.URL)
+	assert.Error(t, err)
+
+	tr, err = New(TLS{Insecure: true, ClientCert: certFile, ClientKey: keyFile})
+	assert.NoError(t, err)
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = New(TLS{ClientCert: certFile})
+	assert.Error(t, err)
+	_, err = New(TLS{ClientCert: keyFile, ClientKey: certFile})
+	assert.Error(t, err)
+}